@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"mydocker/container"
+	"mydocker/utils"
+
+	"github.com/creack/pty"
+	"github.com/pkg/errors"
+)
+
+// 连接到容器监控进程，转发当前终端的输入输出，阻塞直到容器退出或读到脱离按键序列
+// 容器退出时返回其退出码，脱离时返回 utils.ErrDetached，容器继续运行
+func AttachContainer(containerID, detachKeys string) (int, error) {
+	keys, err := utils.ParseDetachKeys(detachKeys)
+	if err != nil {
+		return -1, err
+	}
+
+	info, err := container.GetContainerInfo(containerID)
+	if err != nil {
+		return -1, err
+	}
+	// 前台容器可能在 CLI 连接前就已退出，此时监控进程仍会等待连接并发送保留的输出与退出码，
+	// 因此先尝试连接，连接失败时再根据容器状态报告错误
+	conn, err := container.DialAttach(containerID)
+	if err != nil {
+		switch info.Status {
+		case container.RUNNING, container.PAUSED, container.RESTARTING:
+		default:
+			return -1, errors.Errorf("container %s is not running, status: %s", containerID, info.Status)
+		}
+		if info.MonitorPid == "" {
+			return -1, errors.Errorf("container %s has no monitor process to attach", containerID)
+		}
+		return -1, err
+	}
+	defer conn.Close()
+
+	// 使用伪终端时宿主机终端设置为 raw 模式，控制字符与窗口大小交由容器的伪终端处理
+	if info.Tty {
+		restore, err := utils.MakeStdinRaw()
+		if err != nil {
+			return -1, err
+		}
+		defer restore()
+
+		resize := func() {
+			if size, err := pty.GetsizeFull(os.Stdin); err == nil {
+				_ = conn.Resize(size.Rows, size.Cols)
+			}
+		}
+		resize()
+		defer utils.NotifyWinch(resize)()
+	}
+
+	// 未保持标准输入打开的容器不转发输入，此时只能通过 Ctrl-C 结束 attach
+	detached := make(chan struct{})
+	if info.Tty || info.OpenStdin {
+		go func() {
+			_, err := io.Copy(conn, utils.NewDetachReader(os.Stdin, keys))
+			if err == utils.ErrDetached {
+				close(detached)
+				_ = conn.Close()
+			}
+		}()
+	}
+
+	exitCode, err := conn.Receive(os.Stdout, os.Stderr)
+	select {
+	case <-detached:
+		return 0, utils.ErrDetached
+	default:
+	}
+	return exitCode, err
+}
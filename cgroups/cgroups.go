@@ -1,18 +1,99 @@
 package cgroups
 
 import (
+	"os"
+
 	"mydocker/cgroups/resource"
+	"mydocker/cgroups/subsystemsv2"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
+// 所有容器的cgroup都创建在该路径下，每个容器单独一个子cgroup
+const CgroupRoot = "mydocker"
+
 type CgroupManager interface {
 	Set(res *resource.ResourceConfig) error
 	Apply(pid int, res *resource.ResourceConfig) error
 	Destroy() error
+	// 读取cgroup中因OOM被杀死的进程数
+	OOMKillCount() (uint64, error)
+	// 读取cgroup当前的内存使用量
+	MemoryUsage() (uint64, error)
+	// 读取cgroup当前与峰值进程数
+	PidsStats() (*resource.PidsStats, error)
+	// 读取cgroup的CPU、内存、进程数与IO统计
+	Stats() (*resource.Stats, error)
+	// 冻结或解冻cgroup中的所有进程，状态生效后才返回
+	Freeze(state resource.FreezerState) error
+	// cgroup 的绝对路径, cgroup v1 中为各 subsystem 对应的路径
+	Paths() map[string]string
 }
 
-func NewCgroupManager(path string) CgroupManager {
-	if isUnifiedCgroup() {
+// 根据容器使用的cgroup驱动创建对应的 CgroupManager，未指定驱动时使用 cgroupfs
+func NewCgroupManager(driver, path string) CgroupManager {
+	if driver == DriverSystemd {
+		return NewSystemdManager(path)
+	}
+	if IsUnifiedCgroup() {
 		return NewCgroupManagerV2(path)
 	}
 	return NewCgroupManagerV1(path)
 }
+
+// 打开容器的cgroup目录，配合 clone3 的 CLONE_INTO_CGROUP 使子进程在创建时就位于容器cgroup中，
+// 避免进程启动后再加入cgroup的间隙，需要 5.7 以上的内核
+// 只有 cgroup v2 的 cgroupfs 驱动支持，systemd 驱动的scope在进程创建后才存在，其他情况返回 nil
+func OpenCgroupDir(driver, path string) (*os.File, error) {
+	if driver == DriverSystemd || !IsUnifiedCgroup() {
+		return nil, nil
+	}
+
+	cgroupPath, err := subsystemsv2.CreateCgroup(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "create cgroup %s failed", path)
+	}
+	dir, err := os.OpenFile(cgroupPath, os.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open cgroup %s failed", cgroupPath)
+	}
+	return dir, nil
+}
+
+// 汇总各 subsystem 的资源使用统计，读取失败的 subsystem 对应部分保持为 0
+// e.g., 父cgroup未开启 io controller 时没有 io.stat，cgroup v1 中可能未挂载 blkio
+// 只有所有 subsystem 都读取失败时才返回错误
+func collectStats(cgroup string, subsystems []resource.Subsystem) (*resource.Stats, error) {
+	stats := &resource.Stats{}
+	collected := false
+	var lastErr error
+	for _, subs := range subsystems {
+		ss, ok := subs.(resource.StatsSubsystem)
+		if !ok {
+			continue
+		}
+		// 在副本上读取，失败的 subsystem 不会留下部分数据
+		partial := *stats
+		if err := ss.GetStats(cgroup, &partial); err != nil {
+			lastErr = errors.WithMessagef(err, "get stats of %s subsystem failed", subs.Name())
+			if errors.Is(err, os.ErrNotExist) {
+				logrus.Debug(lastErr)
+			} else {
+				logrus.Warn(lastErr)
+			}
+			continue
+		}
+		*stats = partial
+		collected = true
+	}
+
+	if !collected {
+		if lastErr == nil {
+			lastErr = errors.New("no subsystem provides stats")
+		}
+		return nil, lastErr
+	}
+	return stats, nil
+}
@@ -4,6 +4,7 @@ import (
 	"mydocker/cgroups/resource"
 	"mydocker/cgroups/subsystemsv1"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,7 +28,7 @@ func (m *CgroupManagerV1) Set(res *resource.ResourceConfig) error {
 		err := subs.Set(m.Path, res)
 		if err != nil {
 			logrus.Errorf("Set system: %s, err: %s", subs.Name(), err.Error())
-			return nil
+			return errors.WithMessagef(err, "set %s subsystem failed", subs.Name())
 		}
 	}
 
@@ -57,3 +58,56 @@ func (m *CgroupManagerV1) Destroy() error {
 
 	return nil
 }
+
+func (m *CgroupManagerV1) OOMKillCount() (uint64, error) {
+	for _, subs := range m.Subsystems {
+		if ms, ok := subs.(*subsystemsv1.MemorySubsystem); ok {
+			return ms.OOMKillCount(m.Path)
+		}
+	}
+	return 0, nil
+}
+
+func (m *CgroupManagerV1) MemoryUsage() (uint64, error) {
+	for _, subs := range m.Subsystems {
+		if ms, ok := subs.(*subsystemsv1.MemorySubsystem); ok {
+			return ms.Usage(m.Path)
+		}
+	}
+	return 0, errors.New("memory subsystem not found")
+}
+
+func (m *CgroupManagerV1) PidsStats() (*resource.PidsStats, error) {
+	for _, subs := range m.Subsystems {
+		if ps, ok := subs.(*subsystemsv1.PidsSubsystem); ok {
+			return ps.Stats(m.Path)
+		}
+	}
+	return nil, errors.New("pids subsystem not found")
+}
+
+func (m *CgroupManagerV1) Stats() (*resource.Stats, error) {
+	return collectStats(m.Path, m.Subsystems)
+}
+
+func (m *CgroupManagerV1) Freeze(state resource.FreezerState) error {
+	for _, subs := range m.Subsystems {
+		if fs, ok := subs.(*subsystemsv1.FreezerSubsystem); ok {
+			return fs.Freeze(m.Path, state)
+		}
+	}
+	return errors.New("freezer subsystem not found")
+}
+
+func (m *CgroupManagerV1) Paths() map[string]string {
+	paths := make(map[string]string, len(m.Subsystems))
+	for _, subs := range m.Subsystems {
+		// 未挂载的 subsystem 没有路径
+		cgroupPath, err := subsystemsv1.CgroupPath(subs, m.Path)
+		if err != nil {
+			continue
+		}
+		paths[subs.Name()] = cgroupPath
+	}
+	return paths
+}
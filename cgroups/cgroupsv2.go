@@ -4,6 +4,7 @@ import (
 	"mydocker/cgroups/resource"
 	"mydocker/cgroups/subsystemsv2"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,7 +28,7 @@ func (m *CgroupManagerV2) Set(res *resource.ResourceConfig) error {
 		err := subs.Set(m.Path, res)
 		if err != nil {
 			logrus.Errorf("Set system: %s, err: %s", subs.Name(), err.Error())
-			return nil
+			return errors.WithMessagef(err, "set %s subsystem failed", subs.Name())
 		}
 	}
 
@@ -57,3 +58,47 @@ func (m *CgroupManagerV2) Destroy() error {
 
 	return nil
 }
+
+func (m *CgroupManagerV2) OOMKillCount() (uint64, error) {
+	for _, subs := range m.Subsystems {
+		if ms, ok := subs.(*subsystemsv2.MemorySubsystem); ok {
+			return ms.OOMKillCount(m.Path)
+		}
+	}
+	return 0, nil
+}
+
+func (m *CgroupManagerV2) MemoryUsage() (uint64, error) {
+	for _, subs := range m.Subsystems {
+		if ms, ok := subs.(*subsystemsv2.MemorySubsystem); ok {
+			return ms.Usage(m.Path)
+		}
+	}
+	return 0, errors.New("memory subsystem not found")
+}
+
+func (m *CgroupManagerV2) PidsStats() (*resource.PidsStats, error) {
+	for _, subs := range m.Subsystems {
+		if ps, ok := subs.(*subsystemsv2.PidsSubsystem); ok {
+			return ps.Stats(m.Path)
+		}
+	}
+	return nil, errors.New("pids subsystem not found")
+}
+
+func (m *CgroupManagerV2) Stats() (*resource.Stats, error) {
+	return collectStats(m.Path, m.Subsystems)
+}
+
+func (m *CgroupManagerV2) Freeze(state resource.FreezerState) error {
+	for _, subs := range m.Subsystems {
+		if fs, ok := subs.(*subsystemsv2.FreezerSubsystem); ok {
+			return fs.Freeze(m.Path, state)
+		}
+	}
+	return errors.New("freezer subsystem not found")
+}
+
+func (m *CgroupManagerV2) Paths() map[string]string {
+	return map[string]string{"unified": subsystemsv2.CgroupPath(m.Path)}
+}
@@ -0,0 +1,97 @@
+package cgroups
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// cgroup 驱动，决定由谁来创建与管理容器的cgroup
+const (
+	// 直接读写 cgroup 文件系统
+	DriverCgroupfs = "cgroupfs"
+	// 通过 D-Bus 让 systemd 为容器创建 transient scope，仅支持 cgroup v2
+	DriverSystemd = "systemd"
+)
+
+// systemd 驱动下容器scope所在的默认slice
+const defaultSlice = "system.slice"
+
+// 连接 systemd 以及等待 systemd job 完成的超时时间
+const systemdTimeout = 10 * time.Second
+
+// 检查驱动在当前宿主机上是否可用，不可用的 systemd 驱动会回退到 cgroupfs
+func ResolveDriver(driver string) (string, error) {
+	switch driver {
+	case "", DriverCgroupfs:
+		return DriverCgroupfs, nil
+	case DriverSystemd:
+	default:
+		return "", fmt.Errorf("unknown cgroup driver %s, only %s and %s are supported", driver, DriverCgroupfs, DriverSystemd)
+	}
+
+	if !IsUnifiedCgroup() {
+		logrus.Warnf("%s cgroup driver requires cgroup v2, fall back to %s", DriverSystemd, DriverCgroupfs)
+		return DriverCgroupfs, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdTimeout)
+	defer cancel()
+	conn, err := newSystemdConn(ctx)
+	if err != nil {
+		logrus.Warnf("connect to systemd failed, fall back to %s, %v", DriverCgroupfs, err)
+		return DriverCgroupfs, nil
+	}
+	conn.Close()
+	return DriverSystemd, nil
+}
+
+// 容器对应的cgroup相对路径，parent 为 --cgroup-parent 指定的父cgroup
+// cgroupfs 驱动下为 {parent}/{containerID}，默认为 mydocker/{containerID}
+// systemd 驱动下 parent 为 slice 名，e.g., team-a.slice 对应 team.slice/team-a.slice/mydocker-{containerID}.scope，默认为 system.slice
+func ContainerCgroupPath(driver, parent, containerID string) (string, error) {
+	if driver == DriverSystemd {
+		if parent == "" {
+			parent = defaultSlice
+		}
+		slicePath, err := expandSlice(parent)
+		if err != nil {
+			return "", err
+		}
+		return path.Join(slicePath, scopeName(containerID)), nil
+	}
+
+	// 父cgroup始终位于cgroup根目录之下
+	parent = strings.TrimPrefix(path.Clean("/"+parent), "/")
+	if parent == "" {
+		parent = CgroupRoot
+	}
+	return path.Join(parent, containerID), nil
+}
+
+// systemd 中 slice 的层级由名字中的 - 表示，需要展开为cgroup路径
+// e.g., team-a.slice => team.slice/team-a.slice
+func expandSlice(slice string) (string, error) {
+	name, ok := strings.CutSuffix(slice, ".slice")
+	if !ok || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid cgroup parent %s, must be a slice name like team-a.slice", slice)
+	}
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, "-") || strings.Contains(name, "--") {
+		return "", fmt.Errorf("invalid slice name %s", slice)
+	}
+
+	var slicePath, prefix string
+	for _, part := range strings.Split(name, "-") {
+		slicePath = path.Join(slicePath, prefix+part+".slice")
+		prefix += part + "-"
+	}
+	return slicePath, nil
+}
+
+func scopeName(containerID string) string {
+	return fmt.Sprintf("%s-%s.scope", CgroupRoot, containerID)
+}
@@ -0,0 +1,151 @@
+package resource
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// CFS 默认的调度周期，单位为微秒
+	CpuPeriodDefault = 100000
+
+	MinCpuShares = 2
+	MaxCpuShares = 262144
+)
+
+// 计算 CFS 的 quota 与 period，quota 为 0 表示未设置
+// CpuQuota 优先于按百分比设置的 CpuCfsQuota
+func (rcfg *ResourceConfig) CpuQuotaAndPeriod() (int64, uint64) {
+	period := rcfg.CpuPeriod
+	if period == 0 {
+		period = CpuPeriodDefault
+	}
+	if rcfg.CpuQuota != 0 {
+		return rcfg.CpuQuota, period
+	}
+	if rcfg.CpuCfsQuota != 0 {
+		return int64(period) / 100 * int64(rcfg.CpuCfsQuota), period
+	}
+	return 0, period
+}
+
+// 将 --cpus 指定的CPU个数转换为默认周期下的 quota, e.g., 1.5 -> 150000
+func CpusToQuota(cpus float64) (int64, error) {
+	if cpus <= 0 || cpus > float64(runtime.NumCPU()) {
+		return 0, fmt.Errorf("invalid cpus %v, range of cpus is from 0.01 to %d", cpus, runtime.NumCPU())
+	}
+	quota := int64(cpus * CpuPeriodDefault)
+	if quota < 1000 {
+		return 0, fmt.Errorf("invalid cpus %v, range of cpus is from 0.01 to %d", cpus, runtime.NumCPU())
+	}
+	return quota, nil
+}
+
+// 将 cgroup v1 的 cpu.shares [2, 262144] 线性映射为 cgroup v2 的 cpu.weight [1, 10000]
+func ConvertCpuSharesToWeight(shares uint64) uint64 {
+	if shares == 0 {
+		return 0
+	}
+	return 1 + ((shares-MinCpuShares)*9999)/(MaxCpuShares-MinCpuShares)
+}
+
+// 校验CPU相关的限制，cpuset 中的CPU与内存节点必须处于在线状态
+func (rcfg *ResourceConfig) ValidateCpu() error {
+	if rcfg.CpuCfsQuota < 0 {
+		return fmt.Errorf("invalid cpu quota %d", rcfg.CpuCfsQuota)
+	}
+	if rcfg.CpuPeriod != 0 && (rcfg.CpuPeriod < 1000 || rcfg.CpuPeriod > 1000000) {
+		return fmt.Errorf("cpu period %d should be between 1ms and 1s", rcfg.CpuPeriod)
+	}
+	if rcfg.CpuQuota != 0 && rcfg.CpuQuota != -1 && rcfg.CpuQuota < 1000 {
+		return fmt.Errorf("cpu quota %d should be -1 or larger than 1ms", rcfg.CpuQuota)
+	}
+	if rcfg.CpuShares != 0 && (rcfg.CpuShares < MinCpuShares || rcfg.CpuShares > MaxCpuShares) {
+		return fmt.Errorf("cpu shares %d should be between %d and %d", rcfg.CpuShares, MinCpuShares, MaxCpuShares)
+	}
+	if rcfg.CpuRtRuntime != 0 {
+		period := rcfg.CpuRtPeriod
+		if period == 0 {
+			period = 1000000
+		}
+		if rcfg.CpuRtRuntime > int64(period) {
+			return fmt.Errorf("cpu realtime runtime %d should not be larger than realtime period %d", rcfg.CpuRtRuntime, period)
+		}
+	}
+
+	if rcfg.CpuSet != "" {
+		if err := validateCpuList(rcfg.CpuSet, "/sys/devices/system/cpu/online"); err != nil {
+			return fmt.Errorf("invalid cpuset %s, %v", rcfg.CpuSet, err)
+		}
+	}
+	if rcfg.CpuSetMems != "" {
+		if err := validateCpuList(rcfg.CpuSetMems, "/sys/devices/system/node/online"); err != nil {
+			return fmt.Errorf("invalid cpuset mems %s, %v", rcfg.CpuSetMems, err)
+		}
+	}
+	return nil
+}
+
+// 检查 list 中的每一项都在 onlineFile 记录的列表中
+func validateCpuList(list, onlineFile string) error {
+	requested, err := ParseCpuList(list)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(onlineFile)
+	if err != nil {
+		// 未开启NUMA的内核中没有 node 目录，只有节点0
+		if os.IsNotExist(err) {
+			content = []byte("0")
+		} else {
+			return err
+		}
+	}
+	online, err := ParseCpuList(strings.TrimSpace(string(content)))
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, len(requested))
+	for id := range requested {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if !online[id] {
+			return fmt.Errorf("%d is not online, online: %s", id, strings.TrimSpace(string(content)))
+		}
+	}
+	return nil
+}
+
+// cpuset 列表中允许的最大编号，内核的 NR_CPUS 上限为 8192，避免展开过大的范围
+const maxCpuListID = 8191
+
+// 解析 cpuset 格式的列表, e.g., 0-2,4
+func ParseCpuList(list string) (map[int]bool, error) {
+	ids := make(map[int]bool)
+	for _, part := range strings.Split(list, ",") {
+		start, end, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(start)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid format %s", list)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(end); err != nil || last < first {
+				return nil, fmt.Errorf("invalid format %s", list)
+			}
+		}
+		if last > maxCpuListID {
+			return nil, fmt.Errorf("%d exceeds the maximum id %d", last, maxCpuListID)
+		}
+		for id := first; id <= last; id++ {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
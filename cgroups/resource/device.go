@@ -0,0 +1,76 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mydocker/utils"
+
+	"golang.org/x/sys/unix"
+)
+
+// 块设备的IO限制，Rate 为每秒字节数或每秒IO次数
+type ThrottleDevice struct {
+	Path  string `json:"path"`
+	Major uint32 `json:"major"`
+	Minor uint32 `json:"minor"`
+	Rate  uint64 `json:"rate"`
+}
+
+// blkio.throttle.* 中的格式, e.g., 8:0 1048576
+func (td ThrottleDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", td.Major, td.Minor, td.Rate)
+}
+
+// 解析 --device-read-bps 等参数并将设备路径转换为设备号
+// bytes 为 true 时速率可以带单位, e.g., /dev/sda:1mb, 否则为IO次数, e.g., /dev/sda:1000
+func ParseThrottleDevice(spec string, bytes bool) (ThrottleDevice, error) {
+	idx := strings.LastIndex(spec, ":")
+	if idx <= 0 || idx == len(spec)-1 {
+		return ThrottleDevice{}, fmt.Errorf("invalid device limit %s, should be <device-path>:<rate>", spec)
+	}
+	devPath, rateStr := spec[:idx], spec[idx+1:]
+
+	var rate uint64
+	if bytes {
+		size, err := utils.ParseBytes(rateStr)
+		if err != nil {
+			return ThrottleDevice{}, fmt.Errorf("invalid rate of device limit %s", spec)
+		}
+		rate = uint64(size)
+	} else {
+		iops, err := strconv.ParseUint(rateStr, 10, 64)
+		if err != nil {
+			return ThrottleDevice{}, fmt.Errorf("invalid rate of device limit %s", spec)
+		}
+		rate = iops
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Stat(devPath, &stat); err != nil {
+		return ThrottleDevice{}, fmt.Errorf("stat device %s failed, %v", devPath, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return ThrottleDevice{}, fmt.Errorf("%s is not a block device", devPath)
+	}
+
+	return ThrottleDevice{
+		Path:  devPath,
+		Major: unix.Major(stat.Rdev),
+		Minor: unix.Minor(stat.Rdev),
+		Rate:  rate,
+	}, nil
+}
+
+func ParseThrottleDevices(specs []string, bytes bool) ([]ThrottleDevice, error) {
+	var devices []ThrottleDevice
+	for _, spec := range specs {
+		device, err := ParseThrottleDevice(spec, bytes)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
@@ -0,0 +1,92 @@
+package resource
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"mydocker/utils"
+)
+
+const hugePagesDir = "/sys/kernel/mm/hugepages"
+
+// 单一大小的大页内存限制，PageSize 为 cgroup 文件名中的格式, e.g., 2MB, 1GB
+type HugetlbLimit struct {
+	PageSize string `json:"pagesize"`
+	Limit    uint64 `json:"limit"`
+}
+
+// 从 /sys/kernel/mm/hugepages 中读取内核支持的大页大小, e.g., hugepages-2048kB -> 2MB
+func HugePageSizes() ([]string, error) {
+	entries, err := os.ReadDir(hugePagesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sizes []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), "hugepages-"), "kB")
+		kb, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, pageSizeString(kb<<10))
+	}
+	return sizes, nil
+}
+
+// 与内核中 hugetlb cgroup 文件名的格式一致
+func pageSizeString(size uint64) string {
+	switch {
+	case size >= 1<<30 && size%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", size>>30)
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", size>>20)
+	default:
+		return fmt.Sprintf("%dKB", size>>10)
+	}
+}
+
+// 解析 --hugetlb-limit 参数, e.g., 2MB:1g 表示 2MB 大页最多使用 1g
+func ParseHugetlbLimit(spec string) (HugetlbLimit, error) {
+	pageSizeStr, limitStr, ok := strings.Cut(spec, ":")
+	if !ok {
+		return HugetlbLimit{}, fmt.Errorf("invalid hugetlb limit %s, should be <page-size>:<limit>", spec)
+	}
+	pageSize, err := utils.ParseBytes(pageSizeStr)
+	if err != nil || pageSize == 0 {
+		return HugetlbLimit{}, fmt.Errorf("invalid page size of hugetlb limit %s", spec)
+	}
+	limit, err := utils.ParseBytes(limitStr)
+	if err != nil {
+		return HugetlbLimit{}, fmt.Errorf("invalid limit of hugetlb limit %s", spec)
+	}
+
+	sizes, err := HugePageSizes()
+	if err != nil {
+		return HugetlbLimit{}, fmt.Errorf("read supported huge page sizes failed, %v", err)
+	}
+	size := pageSizeString(uint64(pageSize))
+	for _, supported := range sizes {
+		if supported == size {
+			return HugetlbLimit{PageSize: size, Limit: uint64(limit)}, nil
+		}
+	}
+	return HugetlbLimit{}, fmt.Errorf("huge page size %s is not supported, supported: %s", pageSizeStr, strings.Join(sizes, ", "))
+}
+
+func ParseHugetlbLimits(specs []string) ([]HugetlbLimit, error) {
+	var limits []HugetlbLimit
+	for _, spec := range specs {
+		limit, err := ParseHugetlbLimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, limit)
+	}
+	return limits, nil
+}
@@ -0,0 +1,66 @@
+package resource
+
+import (
+	"fmt"
+
+	"mydocker/utils"
+)
+
+// 内存限制的下限，过小的限制会导致容器进程无法启动
+const MinMemoryLimit = 6 << 20
+
+// 解析为字节数的内存限制，0 表示不设置，Swap 为 -1 表示不限制swap
+type MemoryLimits struct {
+	Limit       int64
+	Swap        int64
+	Reservation int64
+	Kernel      int64
+}
+
+// 解析并校验 ResourceConfig 中带单位的内存限制
+func (rcfg *ResourceConfig) ParseMemory() (*MemoryLimits, error) {
+	limits := &MemoryLimits{}
+	for _, item := range []struct {
+		name      string
+		value     string
+		dest      *int64
+		unlimited bool // 是否允许 -1
+	}{
+		{"memory", rcfg.MemoryLimit, &limits.Limit, false},
+		{"memory swap", rcfg.MemorySwap, &limits.Swap, true},
+		{"memory reservation", rcfg.MemoryReservation, &limits.Reservation, false},
+		{"kernel memory", rcfg.KernelMemory, &limits.Kernel, false},
+	} {
+		if item.value == "" {
+			continue
+		}
+		if item.value == "-1" && item.unlimited {
+			*item.dest = -1
+			continue
+		}
+		size, err := utils.ParseBytes(item.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s", item.name, item.value)
+		}
+		*item.dest = size
+	}
+
+	if limits.Limit != 0 && limits.Limit < MinMemoryLimit {
+		return nil, fmt.Errorf("minimum memory limit allowed is 6MB")
+	}
+	if limits.Swap != 0 {
+		if limits.Limit == 0 {
+			return nil, fmt.Errorf("memory swap can only be set together with memory limit")
+		}
+		if limits.Swap > 0 && limits.Swap < limits.Limit {
+			return nil, fmt.Errorf("memory swap %s should be larger than memory limit %s", rcfg.MemorySwap, rcfg.MemoryLimit)
+		}
+	}
+	if limits.Reservation != 0 && limits.Limit != 0 && limits.Reservation > limits.Limit {
+		return nil, fmt.Errorf("memory reservation %s should be smaller than memory limit %s", rcfg.MemoryReservation, rcfg.MemoryLimit)
+	}
+	if limits.Kernel != 0 && limits.Kernel < MinMemoryLimit {
+		return nil, fmt.Errorf("minimum kernel memory limit allowed is 6MB")
+	}
+	return limits, nil
+}
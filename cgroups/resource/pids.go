@@ -0,0 +1,29 @@
+package resource
+
+import (
+	"path"
+	"strconv"
+
+	"mydocker/utils"
+)
+
+// pids.max 中不限制进程数时为 max，cgroup v1 与 v2 格式相同
+func PidsMax(limit int64) string {
+	if limit < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// 读取 cgroup 目录下的 pids.current 与 pids.peak
+func ReadPidsStats(cgroupPath string) (*PidsStats, error) {
+	current, err := utils.ReadUint(path.Join(cgroupPath, "pids.current"))
+	if err != nil {
+		return nil, err
+	}
+	stats := &PidsStats{Current: current}
+
+	// 旧内核中没有 pids.peak
+	stats.Peak, _ = utils.ReadUint(path.Join(cgroupPath, "pids.peak"))
+	return stats, nil
+}
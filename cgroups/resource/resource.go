@@ -16,7 +16,92 @@ type Subsystem interface {
 }
 
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuCfsQuota int
-	CpuSet      string
+	MemoryLimit string `json:"memorylimit"`
+	CpuCfsQuota int    `json:"cpucfsquota"`
+	CpuSet      string `json:"cpuset"`
+	// 允许使用的内存节点, e.g., 0-1
+	CpuSetMems string `json:"cpusetmems"`
+	// CFS 调度周期与周期内可用的CPU时间，单位为微秒，CpuQuota 为 -1 表示不限制
+	// 设置 CpuQuota 时忽略按百分比设置的 CpuCfsQuota
+	CpuPeriod uint64 `json:"cpuperiod"`
+	CpuQuota  int64  `json:"cpuquota"`
+	// CPU的相对权重，cgroup v1 中范围为 2 ~ 262144, cgroup v2 中转换为 cpu.weight
+	CpuShares uint64 `json:"cpushares"`
+	// 实时调度的周期与周期内可用的时间，单位为微秒，只有 cgroup v1 支持
+	CpuRtPeriod  uint64 `json:"cpurtperiod"`
+	CpuRtRuntime int64  `json:"cpurtruntime"`
+	// 内存限制均为带单位的字节数, e.g., 100m，空字符串表示不设置
+	// 内存与swap的总限制，-1 表示不限制swap
+	MemorySwap string `json:"memoryswap"`
+	// 内存软限制，内存紧张时优先回收超出该值的容器
+	MemoryReservation string `json:"memoryreservation"`
+	// 内核内存限制，只有 cgroup v1 且内核版本低于 5.16 时支持
+	KernelMemory string `json:"kernelmemory"`
+	// 超出内存限制时不杀死进程，只有 cgroup v1 支持
+	OomKillDisable bool `json:"oomkilldisable"`
+
+	// 容器内的最大进程数，0 表示不限制，-1 表示显式设置为不限制
+	PidsLimit int64 `json:"pidslimit"`
+
+	// 各种大小的大页内存限制
+	HugetlbLimits []HugetlbLimit `json:"hugetlblimits"`
+
+	// 块设备IO的相对权重, 范围 10 ~ 1000, 0 表示不设置
+	BlkioWeight uint16 `json:"blkioweight"`
+	// 对单个块设备的IO限速
+	BlkioDeviceReadBps   []ThrottleDevice `json:"blkiodevicereadbps"`
+	BlkioDeviceWriteBps  []ThrottleDevice `json:"blkiodevicewritebps"`
+	BlkioDeviceReadIOps  []ThrottleDevice `json:"blkiodevicereadiops"`
+	BlkioDeviceWriteIOps []ThrottleDevice `json:"blkiodevicewriteiops"`
+}
+
+// cgroup 中的进程数统计
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	// 进程数的历史峰值，内核不支持 pids.peak 时为 0
+	Peak uint64 `json:"peak"`
+}
+
+// cgroup freezer 的状态
+type FreezerState string
+
+const (
+	Frozen FreezerState = "FROZEN"
+	Thawed FreezerState = "THAWED"
+)
+
+// cgroup 的资源使用统计，时间单位均为纳秒
+type Stats struct {
+	Cpu    CpuStats    `json:"cpu"`
+	Memory MemoryStats `json:"memory"`
+	Pids   PidsStats   `json:"pids"`
+	Io     IoStats     `json:"io"`
+}
+
+type CpuStats struct {
+	UsageNs       uint64 `json:"usagens"`
+	UserNs        uint64 `json:"userns"`
+	SystemNs      uint64 `json:"systemns"`
+	NrPeriods     uint64 `json:"nrperiods"`
+	NrThrottled   uint64 `json:"nrthrottled"`
+	ThrottledTime uint64 `json:"throttledtime"`
+}
+
+type MemoryStats struct {
+	Usage uint64 `json:"usage"`
+	// 内存用量的历史峰值，内核不支持 memory.peak 时为 0
+	Peak  uint64 `json:"peak"`
+	Cache uint64 `json:"cache"`
+	// 内存限制，未限制时为 0
+	Limit uint64 `json:"limit"`
+}
+
+type IoStats struct {
+	ReadBytes  uint64 `json:"readbytes"`
+	WriteBytes uint64 `json:"writebytes"`
+}
+
+// 可以提供资源使用统计的 subsystem
+type StatsSubsystem interface {
+	GetStats(cgroup string, stats *Stats) error
 }
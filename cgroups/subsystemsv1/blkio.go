@@ -0,0 +1,116 @@
+package subsystemsv1
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"mydocker/cgroups/resource"
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
+)
+
+type BlkioSubsystem struct {
+}
+
+func (bs *BlkioSubsystem) Name() string {
+	return "blkio"
+}
+
+func (bs *BlkioSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	throttles := map[string][]resource.ThrottleDevice{
+		"blkio.throttle.read_bps_device":   rcfg.BlkioDeviceReadBps,
+		"blkio.throttle.write_bps_device":  rcfg.BlkioDeviceWriteBps,
+		"blkio.throttle.read_iops_device":  rcfg.BlkioDeviceReadIOps,
+		"blkio.throttle.write_iops_device": rcfg.BlkioDeviceWriteIOps,
+	}
+	hasThrottle := false
+	for _, devices := range throttles {
+		hasThrottle = hasThrottle || len(devices) > 0
+	}
+	if rcfg.BlkioWeight == 0 && !hasThrottle {
+		return nil
+	}
+
+	cgroupPath, err := getCgroupPath(bs, cgroup, true)
+	if err != nil {
+		return err
+	}
+
+	if rcfg.BlkioWeight != 0 {
+		// 未启用CFQ调度器的内核中只有BFQ调度器提供的 blkio.bfq.weight
+		weightFile := path.Join(cgroupPath, "blkio.weight")
+		if exist, _ := utils.PathExist(weightFile); !exist {
+			weightFile = path.Join(cgroupPath, "blkio.bfq.weight")
+		}
+		if err = os.WriteFile(weightFile, []byte(strconv.Itoa(int(rcfg.BlkioWeight))), 0644); err != nil {
+			return errors.Wrap(err, "set blkio weight fail")
+		}
+	}
+
+	// 每次只能写入一个设备的限制
+	for file, devices := range throttles {
+		for _, device := range devices {
+			if err = os.WriteFile(path.Join(cgroupPath, file), []byte(device.String()), 0644); err != nil {
+				return errors.Wrapf(err, "set %s of device %s fail", file, device.Path)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (bs *BlkioSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	cgroupPath, err := getCgroupPath(bs, cgroup, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return errors.Wrap(err, "set process fail")
+	}
+
+	return nil
+}
+
+func (bs *BlkioSubsystem) Remove(cgroup string) error {
+	cgroupPath, err := getCgroupPath(bs, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(cgroupPath)
+}
+
+// 从 blkio.throttle.io_service_bytes_recursive 统计所有设备的读写字节数
+// 其中每行的格式为 8:0 Read 4096，最后一行为 Total
+func (bs *BlkioSubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	cgroupPath, err := getCgroupPath(bs, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(path.Join(cgroupPath, "blkio.throttle.io_service_bytes_recursive"))
+	if err != nil {
+		return errors.Wrap(err, "read blkio.throttle.io_service_bytes_recursive fail")
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "Read":
+			stats.Io.ReadBytes += value
+		case "Write":
+			stats.Io.WriteBytes += value
+		}
+	}
+	return nil
+}
@@ -11,8 +11,6 @@ import (
 	"mydocker/utils"
 )
 
-const PeriodDefault = 100000
-
 type CpuSubsystem struct {
 }
 
@@ -21,7 +19,9 @@ func (cs *CpuSubsystem) Name() string {
 }
 
 func (cs *CpuSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuCfsQuota == 0 {
+	quota, period := rcfg.CpuQuotaAndPeriod()
+	if quota == 0 && rcfg.CpuPeriod == 0 && rcfg.CpuShares == 0 &&
+		rcfg.CpuRtPeriod == 0 && rcfg.CpuRtRuntime == 0 {
 		return nil
 	}
 
@@ -30,26 +30,40 @@ func (cs *CpuSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error
 		return err
 	}
 
-	if rcfg.CpuCfsQuota != 0 {
-		if err = os.WriteFile(path.Join(cgroupPath, "cpu.cfs_period_us"), []byte(strconv.Itoa(PeriodDefault)), 0644); err != nil {
-			return errors.Wrap(err, "set cpu period fail")
+	if rcfg.CpuShares != 0 {
+		if err = utils.WriteUint(path.Join(cgroupPath, "cpu.shares"), rcfg.CpuShares); err != nil {
+			return errors.Wrap(err, "set cpu shares fail")
 		}
+	}
 
-		cpuQuota := PeriodDefault / 100 * rcfg.CpuCfsQuota
-		if err = os.WriteFile(path.Join(cgroupPath, "cpu.cfs_quota_us"), []byte(strconv.Itoa(cpuQuota)), 0644); err != nil {
+	if quota != 0 || rcfg.CpuPeriod != 0 {
+		if err = utils.WriteUint(path.Join(cgroupPath, "cpu.cfs_period_us"), period); err != nil {
+			return errors.Wrap(err, "set cpu period fail")
+		}
+	}
+	if quota != 0 {
+		if err = utils.WriteInt(path.Join(cgroupPath, "cpu.cfs_quota_us"), quota); err != nil {
 			return errors.Wrap(err, "set cpu quota fail")
 		}
 	}
 
+	// 实时调度的 runtime 不能超过 period，需要先修改 period
+	if rcfg.CpuRtPeriod != 0 {
+		if err = utils.WriteUint(path.Join(cgroupPath, "cpu.rt_period_us"), rcfg.CpuRtPeriod); err != nil {
+			return errors.Wrap(err, "set cpu realtime period fail")
+		}
+	}
+	if rcfg.CpuRtRuntime != 0 {
+		if err = utils.WriteInt(path.Join(cgroupPath, "cpu.rt_runtime_us"), rcfg.CpuRtRuntime); err != nil {
+			return errors.Wrap(err, "set cpu realtime runtime fail")
+		}
+	}
+
 	return nil
 }
 
 func (cs *CpuSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuCfsQuota == 0 {
-		return nil
-	}
-
-	cgroupPath, err := getCgroupPath(cs, cgroup, false)
+	cgroupPath, err := getCgroupPath(cs, cgroup, true)
 	if err != nil {
 		return err
 	}
@@ -58,7 +72,7 @@ func (cs *CpuSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceCon
 		return errors.Wrap(err, "cpu cgroup does not exist")
 	}
 
-	if err = os.WriteFile(path.Join(cgroupPath, "tasks"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
 		return errors.Wrap(err, "set process fail")
 	}
 
@@ -72,3 +86,20 @@ func (cs *CpuSubsystem) Remove(cgroup string) error {
 	}
 	return os.RemoveAll(cgroupPath)
 }
+
+// 读取CFS带宽限制导致的节流统计
+func (cs *CpuSubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	cgroupPath, err := getCgroupPath(cs, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	values, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "cpu.stat"))
+	if err != nil {
+		return errors.Wrap(err, "read cpu.stat fail")
+	}
+	stats.Cpu.NrPeriods = values["nr_periods"]
+	stats.Cpu.NrThrottled = values["nr_throttled"]
+	stats.Cpu.ThrottledTime = values["throttled_time"]
+	return nil
+}
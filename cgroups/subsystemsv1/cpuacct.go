@@ -0,0 +1,69 @@
+package subsystemsv1
+
+import (
+	"os"
+	"path"
+	"strconv"
+
+	"mydocker/cgroups/resource"
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
+)
+
+// cpuacct.stat 中的时间单位为 USER_HZ
+const clockTicks = 100
+
+// cgroup v1 中CPU的使用统计由单独的 cpuacct subsystem 提供
+type CpuacctSubsystem struct {
+}
+
+func (cas *CpuacctSubsystem) Name() string {
+	return "cpuacct"
+}
+
+// cpuacct 只统计不限制资源
+func (cas *CpuacctSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	return nil
+}
+
+func (cas *CpuacctSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	cgroupPath, err := getCgroupPath(cas, cgroup, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return errors.Wrap(err, "set process fail")
+	}
+
+	return nil
+}
+
+func (cas *CpuacctSubsystem) Remove(cgroup string) error {
+	cgroupPath, err := getCgroupPath(cas, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(cgroupPath)
+}
+
+func (cas *CpuacctSubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	cgroupPath, err := getCgroupPath(cas, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	if stats.Cpu.UsageNs, err = utils.ReadUint(path.Join(cgroupPath, "cpuacct.usage")); err != nil {
+		return err
+	}
+
+	values, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "cpuacct.stat"))
+	if err != nil {
+		return errors.Wrap(err, "read cpuacct.stat fail")
+	}
+	stats.Cpu.UserNs = values["user"] * (1e9 / clockTicks)
+	stats.Cpu.SystemNs = values["system"] * (1e9 / clockTicks)
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	"mydocker/cgroups/resource"
 	"mydocker/utils"
@@ -19,7 +20,7 @@ func (css *CpusetSubsystem) Name() string {
 }
 
 func (css *CpusetSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuSet == "" {
+	if rcfg.CpuSet == "" && rcfg.CpuSetMems == "" {
 		return nil
 	}
 
@@ -27,29 +28,38 @@ func (css *CpusetSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) er
 	if err != nil {
 		return err
 	}
+	if err = initCpuset(cgroup); err != nil {
+		return err
+	}
 
-	if err = os.WriteFile(path.Join(cgroupPath, "cpuset.cpus"), []byte(rcfg.CpuSet), 0644); err != nil {
-		return errors.Wrap(err, "set cpuset fail")
+	if rcfg.CpuSet != "" {
+		if err = os.WriteFile(path.Join(cgroupPath, "cpuset.cpus"), []byte(rcfg.CpuSet), 0644); err != nil {
+			return errors.Wrap(err, "set cpuset fail")
+		}
+	}
+	if rcfg.CpuSetMems != "" {
+		if err = os.WriteFile(path.Join(cgroupPath, "cpuset.mems"), []byte(rcfg.CpuSetMems), 0644); err != nil {
+			return errors.Wrap(err, "set cpuset mems fail")
+		}
 	}
 
 	return nil
 }
 
 func (css *CpusetSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuSet == "" {
-		return nil
-	}
-
-	cgroupPath, err := getCgroupPath(css, cgroup, false)
+	cgroupPath, err := getCgroupPath(css, cgroup, true)
 	if err != nil {
 		return err
 	}
+	if err = initCpuset(cgroup); err != nil {
+		return err
+	}
 
 	if exist, err := utils.PathExist(cgroupPath); !exist {
 		return errors.Wrap(err, "cpuset cgroup does not exist")
 	}
 
-	if err = os.WriteFile(path.Join(cgroupPath, "tasks"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
 		return errors.Wrap(err, "set process fail")
 	}
 
@@ -63,3 +73,37 @@ func (css *CpusetSubsystem) Remove(cgroup string) error {
 	}
 	return os.RemoveAll(cgroupPath)
 }
+
+// cgroup v1 中新建的 cpuset cgroup 的 cpuset.cpus 和 cpuset.mems 为空，
+// 此时无法加入进程，需要从上级 cgroup 逐级继承
+func initCpuset(cgroup string) error {
+	mountPath, err := findSubsystemMountPath("cpuset")
+	if err != nil {
+		return err
+	}
+
+	parent := mountPath
+	for _, dir := range strings.Split(strings.Trim(cgroup, "/"), "/") {
+		current := path.Join(parent, dir)
+		for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+			content, err := os.ReadFile(path.Join(current, file))
+			if err != nil {
+				return errors.Wrapf(err, "read %s fail", file)
+			}
+			if strings.TrimSpace(string(content)) != "" {
+				continue
+			}
+
+			parentContent, err := os.ReadFile(path.Join(parent, file))
+			if err != nil {
+				return errors.Wrapf(err, "read %s fail", file)
+			}
+			if err = os.WriteFile(path.Join(current, file), parentContent, 0644); err != nil {
+				return errors.Wrapf(err, "init %s fail", file)
+			}
+		}
+		parent = current
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package subsystemsv1
+
+import (
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"mydocker/cgroups/resource"
+
+	"github.com/pkg/errors"
+)
+
+// 冻结或解冻时轮询 freezer.state 的间隔与次数
+const (
+	freezeRetryInterval = 10 * time.Millisecond
+	freezeRetryTimes    = 1000
+)
+
+type FreezerSubsystem struct {
+}
+
+func (fs *FreezerSubsystem) Name() string {
+	return "freezer"
+}
+
+// freezer 不限制资源，只在 pause/unpause 时修改状态
+func (fs *FreezerSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	return nil
+}
+
+func (fs *FreezerSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	cgroupPath, err := getCgroupPath(fs, cgroup, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return errors.Wrap(err, "set process fail")
+	}
+
+	return nil
+}
+
+func (fs *FreezerSubsystem) Remove(cgroup string) error {
+	cgroupPath, err := getCgroupPath(fs, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(cgroupPath)
+}
+
+// 修改 freezer.state 并等待状态生效
+// 冻结过程中 freezer.state 会短暂处于 FREEZING，若有进程未能及时冻结则需要重新写入
+func (fs *FreezerSubsystem) Freeze(cgroup string, state resource.FreezerState) error {
+	cgroupPath, err := getCgroupPath(fs, cgroup, false)
+	if err != nil {
+		return err
+	}
+	statePath := path.Join(cgroupPath, "freezer.state")
+
+	for i := 0; i < freezeRetryTimes; i++ {
+		if err = os.WriteFile(statePath, []byte(state), 0644); err != nil {
+			return errors.Wrapf(err, "write %s to freezer.state fail", state)
+		}
+		current, err := os.ReadFile(statePath)
+		if err != nil {
+			return errors.Wrap(err, "read freezer.state fail")
+		}
+		if resource.FreezerState(strings.TrimSpace(string(current))) == state {
+			return nil
+		}
+		time.Sleep(freezeRetryInterval)
+	}
+
+	return errors.Errorf("wait for freezer state %s timeout", state)
+}
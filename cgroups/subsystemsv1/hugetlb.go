@@ -0,0 +1,71 @@
+package subsystemsv1
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"mydocker/cgroups/resource"
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
+)
+
+type HugetlbSubsystem struct {
+}
+
+func (hs *HugetlbSubsystem) Name() string {
+	return "hugetlb"
+}
+
+func (hs *HugetlbSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	if len(rcfg.HugetlbLimits) == 0 {
+		return nil
+	}
+
+	cgroupPath, err := getCgroupPath(hs, cgroup, true)
+	if err != nil {
+		return err
+	}
+
+	for _, limit := range rcfg.HugetlbLimits {
+		file := fmt.Sprintf("hugetlb.%s.limit_in_bytes", limit.PageSize)
+		if err = utils.WriteUint(path.Join(cgroupPath, file), limit.Limit); err != nil {
+			return errors.Wrapf(err, "set hugetlb limit of %s fail", limit.PageSize)
+		}
+	}
+
+	return nil
+}
+
+func (hs *HugetlbSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	// 部分系统中没有挂载 hugetlb，未设置限制时不需要加入
+	if _, err := findSubsystemMountPath(hs.Name()); err != nil && len(rcfg.HugetlbLimits) == 0 {
+		return nil
+	}
+
+	cgroupPath, err := getCgroupPath(hs, cgroup, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return errors.Wrap(err, "set process fail")
+	}
+
+	return nil
+}
+
+func (hs *HugetlbSubsystem) Remove(cgroup string) error {
+	if _, err := findSubsystemMountPath(hs.Name()); err != nil {
+		return nil
+	}
+
+	cgroupPath, err := getCgroupPath(hs, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(cgroupPath)
+}
@@ -4,13 +4,18 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	"mydocker/cgroups/resource"
 	"mydocker/utils"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
+// memory.limit_in_bytes 不小于该值时视为不限制
+const unlimitedMemory = 1 << 62
+
 type MemorySubsystem struct {
 }
 
@@ -19,7 +24,11 @@ func (ms *MemorySubsystem) Name() string {
 }
 
 func (ms *MemorySubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
-	if rcfg.MemoryLimit == "" {
+	limits, err := rcfg.ParseMemory()
+	if err != nil {
+		return err
+	}
+	if *limits == (resource.MemoryLimits{}) && !rcfg.OomKillDisable {
 		return nil
 	}
 
@@ -28,19 +37,73 @@ func (ms *MemorySubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) err
 		return err
 	}
 
-	if err = os.WriteFile(path.Join(cgroupPath, "memory.limit_in_bytes"), []byte(rcfg.MemoryLimit), 0644); err != nil {
-		return errors.Wrap(err, "set memory fail")
+	if err = setMemoryAndSwap(cgroupPath, limits); err != nil {
+		return err
+	}
+
+	if limits.Reservation != 0 {
+		if err = utils.WriteInt(path.Join(cgroupPath, "memory.soft_limit_in_bytes"), limits.Reservation); err != nil {
+			return errors.Wrap(err, "set memory reservation fail")
+		}
+	}
+
+	// 5.16 以上的内核不再支持限制内核内存
+	if limits.Kernel != 0 {
+		if err = utils.WriteInt(path.Join(cgroupPath, "memory.kmem.limit_in_bytes"), limits.Kernel); err != nil {
+			logrus.Warnf("kernel memory limit is not supported, %v", err)
+		}
+	}
+
+	if rcfg.OomKillDisable {
+		if err = os.WriteFile(path.Join(cgroupPath, "memory.oom_control"), []byte("1"), 0644); err != nil {
+			return errors.Wrap(err, "disable oom killer fail")
+		}
 	}
 
 	return nil
 }
 
-func (ms *MemorySubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
-	if rcfg.MemoryLimit == "" {
-		return nil
+// memory.memsw.limit_in_bytes 不能小于 memory.limit_in_bytes，
+// 调大限制时需要先修改swap限制，调小时则先修改内存限制
+func setMemoryAndSwap(cgroupPath string, limits *resource.MemoryLimits) error {
+	limitFile := path.Join(cgroupPath, "memory.limit_in_bytes")
+	swapFile := path.Join(cgroupPath, "memory.memsw.limit_in_bytes")
+	if limits.Swap != 0 {
+		if exist, _ := utils.PathExist(swapFile); !exist {
+			return errors.New("memory swap limit is not supported, swap accounting may be disabled")
+		}
 	}
 
-	cgroupPath, err := getCgroupPath(ms, cgroup, false)
+	swapFirst := false
+	if limits.Swap != 0 && limits.Limit != 0 {
+		current, err := os.ReadFile(limitFile)
+		if err != nil {
+			return errors.Wrap(err, "read memory limit fail")
+		}
+		currentLimit, _ := strconv.ParseInt(strings.TrimSpace(string(current)), 10, 64)
+		swapFirst = limits.Swap == -1 || limits.Limit > currentLimit
+	}
+
+	if swapFirst {
+		if err := utils.WriteInt(swapFile, limits.Swap); err != nil {
+			return errors.Wrap(err, "set memory swap fail")
+		}
+	}
+	if limits.Limit != 0 {
+		if err := utils.WriteInt(limitFile, limits.Limit); err != nil {
+			return errors.Wrap(err, "set memory fail")
+		}
+	}
+	if !swapFirst && limits.Swap != 0 {
+		if err := utils.WriteInt(swapFile, limits.Swap); err != nil {
+			return errors.Wrap(err, "set memory swap fail")
+		}
+	}
+	return nil
+}
+
+func (ms *MemorySubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	cgroupPath, err := getCgroupPath(ms, cgroup, true)
 	if err != nil {
 		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
 	}
@@ -49,7 +112,7 @@ func (ms *MemorySubsystem) Apply(cgroup string, pid int, rcfg *resource.Resource
 		return errors.Wrap(err, "memory cgroup does not exist")
 	}
 
-	if err = os.WriteFile(path.Join(cgroupPath, "tasks"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
 		return errors.Wrap(err, "set process fail")
 	}
 
@@ -64,3 +127,53 @@ func (ms *MemorySubsystem) Remove(cgroup string) error {
 
 	return os.RemoveAll(cgroupPath)
 }
+
+// 读取cgroup中因OOM被杀死的进程数, 需要内核 4.13 以上
+func (ms *MemorySubsystem) OOMKillCount(cgroup string) (uint64, error) {
+	cgroupPath, err := getCgroupPath(ms, cgroup, false)
+	if err != nil {
+		return 0, err
+	}
+
+	values, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "memory.oom_control"))
+	if err != nil {
+		return 0, errors.Wrap(err, "read memory.oom_control fail")
+	}
+	return values["oom_kill"], nil
+}
+
+func (ms *MemorySubsystem) Usage(cgroup string) (uint64, error) {
+	cgroupPath, err := getCgroupPath(ms, cgroup, false)
+	if err != nil {
+		return 0, err
+	}
+	return utils.ReadUint(path.Join(cgroupPath, "memory.usage_in_bytes"))
+}
+
+func (ms *MemorySubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	cgroupPath, err := getCgroupPath(ms, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	for file, dest := range map[string]*uint64{
+		"memory.usage_in_bytes":     &stats.Memory.Usage,
+		"memory.max_usage_in_bytes": &stats.Memory.Peak,
+		"memory.limit_in_bytes":     &stats.Memory.Limit,
+	} {
+		if *dest, err = utils.ReadUint(path.Join(cgroupPath, file)); err != nil {
+			return err
+		}
+	}
+	// 未限制时 memory.limit_in_bytes 为一个接近 int64 上限的值
+	if stats.Memory.Limit >= unlimitedMemory {
+		stats.Memory.Limit = 0
+	}
+
+	values, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "memory.stat"))
+	if err != nil {
+		return errors.Wrap(err, "read memory.stat fail")
+	}
+	stats.Memory.Cache = values["total_cache"]
+	return nil
+}
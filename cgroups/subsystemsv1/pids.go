@@ -0,0 +1,74 @@
+package subsystemsv1
+
+import (
+	"os"
+	"path"
+	"strconv"
+
+	"mydocker/cgroups/resource"
+
+	"github.com/pkg/errors"
+)
+
+type PidsSubsystem struct {
+}
+
+func (ps *PidsSubsystem) Name() string {
+	return "pids"
+}
+
+func (ps *PidsSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	if rcfg.PidsLimit == 0 {
+		return nil
+	}
+
+	cgroupPath, err := getCgroupPath(ps, cgroup, true)
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(path.Join(cgroupPath, "pids.max"), []byte(resource.PidsMax(rcfg.PidsLimit)), 0644); err != nil {
+		return errors.Wrap(err, "set pids limit fail")
+	}
+
+	return nil
+}
+
+func (ps *PidsSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	cgroupPath, err := getCgroupPath(ps, cgroup, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup %s", cgroupPath)
+	}
+
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return errors.Wrap(err, "set process fail")
+	}
+
+	return nil
+}
+
+func (ps *PidsSubsystem) Remove(cgroup string) error {
+	cgroupPath, err := getCgroupPath(ps, cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(cgroupPath)
+}
+
+func (ps *PidsSubsystem) Stats(cgroup string) (*resource.PidsStats, error) {
+	cgroupPath, err := getCgroupPath(ps, cgroup, false)
+	if err != nil {
+		return nil, err
+	}
+	return resource.ReadPidsStats(cgroupPath)
+}
+
+func (ps *PidsSubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	pids, err := ps.Stats(cgroup)
+	if err != nil {
+		return err
+	}
+	stats.Pids = *pids
+	return nil
+}
@@ -6,6 +6,11 @@ import (
 
 var SubsystemSet = []resource.Subsystem{
 	&CpuSubsystem{},
+	&CpuacctSubsystem{},
 	&CpusetSubsystem{},
 	&MemorySubsystem{},
+	&PidsSubsystem{},
+	&BlkioSubsystem{},
+	&HugetlbSubsystem{},
+	&FreezerSubsystem{},
 }
@@ -2,21 +2,20 @@ package subsystemsv1
 
 import (
 	"bufio"
-	"fmt"
 	"mydocker/cgroups/resource"
 	"os"
 	"path"
 	"strings"
 
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 // Get the absolute path of a Cgroup
 func getCgroupPath(subsystem resource.Subsystem, cgroup string, autoCreate bool) (string, error) {
+	// 未挂载的 subsystem 没有对应的 hierarchy，不能继续拼接出相对路径
 	mountPath, err := findSubsystemMountPath(subsystem.Name())
 	if err != nil {
-		logrus.Error(err)
+		return "", err
 	}
 	cgroupPath := path.Join(mountPath, cgroup)
 
@@ -26,7 +25,8 @@ func getCgroupPath(subsystem resource.Subsystem, cgroup string, autoCreate bool)
 
 	_, err = os.Stat(cgroupPath)
 	if err != nil && os.IsNotExist(err) {
-		err = os.Mkdir(cgroupPath, 0755)
+		// 容器cgroup为多级目录 mydocker/{containerID}，需要逐级创建
+		err = os.MkdirAll(cgroupPath, 0755)
 		return cgroupPath, err
 	}
 
@@ -65,5 +65,76 @@ func findSubsystemMountPath(subsystem string) (string, error) {
 		return "", err
 	}
 
-	return "", fmt.Errorf("mount dir of %s not found", subsystem)
+	// 包装 os.ErrNotExist，调用方可以据此区分未挂载的 subsystem
+	return "", errors.Wrapf(os.ErrNotExist, "mount dir of %s not found", subsystem)
+}
+
+// 宿主机上挂载的一个 cgroup hierarchy
+type Hierarchy struct {
+	MountPoint string // 挂载点, e.g., /sys/fs/cgroup/cpu
+	Type       string // cgroup 或 cgroup2
+	Options    string // hierarchy 关联的 subsystem, e.g., cpu,cpuacct 或 name=systemd
+}
+
+// hierarchy 关联的 subsystem, name=xxx 形式的命名 hierarchy 不包含 subsystem
+func (h Hierarchy) Subsystems() []string {
+	var subsystems []string
+	for _, opt := range strings.Split(h.Options, ",") {
+		if opt != "" && !strings.HasPrefix(opt, "name=") {
+			subsystems = append(subsystems, opt)
+		}
+	}
+	return subsystems
+}
+
+// 从 /proc/self/mountinfo 中找出所有 cgroup hierarchy
+// 同一个 hierarchy 可能被挂载多次, e.g., bind mount 到其他路径，只保留第一个挂载点
+func Hierarchies() ([]Hierarchy, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var hierarchies []Hierarchy
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 分隔符 - 之后依次为文件系统类型、挂载源与超级块选项
+		line := scanner.Text()
+		_, post, ok := strings.Cut(line, " - ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(post)
+		if len(fields) < 3 || (fields[0] != "cgroup" && fields[0] != "cgroup2") {
+			continue
+		}
+
+		var opts []string
+		for _, opt := range strings.Split(fields[2], ",") {
+			if opt == "rw" || opt == "ro" || opt == "xattr" || opt == "clone_children" ||
+				strings.HasPrefix(opt, "release_agent=") {
+				continue
+			}
+			opts = append(opts, opt)
+		}
+		// 挂载源与选项相同的是同一个 hierarchy
+		key := fields[0] + " " + fields[1] + " " + strings.Join(opts, ",")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		hierarchies = append(hierarchies, Hierarchy{
+			MountPoint: strings.Fields(line)[mountPointIndex],
+			Type:       fields[0],
+			Options:    strings.Join(opts, ","),
+		})
+	}
+	return hierarchies, scanner.Err()
+}
+
+// 获取 cgroup 在指定 subsystem hierarchy 中的绝对路径，不会自动创建
+func CgroupPath(subsystem resource.Subsystem, cgroup string) (string, error) {
+	return getCgroupPath(subsystem, cgroup, false)
 }
@@ -6,12 +6,12 @@ import (
 	"path"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
 	"mydocker/cgroups/resource"
+	"mydocker/utils"
 )
 
-const PeriodDefault = 100000
-
 type CpuSubsystem struct {
 }
 
@@ -20,31 +20,42 @@ func (cs *CpuSubsystem) Name() string {
 }
 
 func (cs *CpuSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuCfsQuota == 0 {
+	quota, period := rcfg.CpuQuotaAndPeriod()
+	if quota == 0 && rcfg.CpuShares == 0 && rcfg.CpuRtPeriod == 0 && rcfg.CpuRtRuntime == 0 {
 		return nil
 	}
 
-	cgroupPath, err := getCgroupPath(cgroup, true)
+	cgroupPath, err := getControllerPath(cgroup, "cpu")
 	if err != nil {
 		return err
 	}
 
+	if rcfg.CpuShares != 0 {
+		weight := resource.ConvertCpuSharesToWeight(rcfg.CpuShares)
+		if err = utils.WriteUint(path.Join(cgroupPath, "cpu.weight"), weight); err != nil {
+			return errors.Wrap(err, "set cpu weight fail")
+		}
+	}
+
 	// cgroupv2 中统一用cpu.max
-	if rcfg.CpuCfsQuota != 0 {
-		cpuQuota := PeriodDefault / 100 * rcfg.CpuCfsQuota
-		configStr := fmt.Sprintf("%d %d", cpuQuota, PeriodDefault)
+	if quota != 0 {
+		configStr := fmt.Sprintf("%d %d", quota, period)
+		if quota < 0 {
+			configStr = fmt.Sprintf("max %d", period)
+		}
 		if err = os.WriteFile(path.Join(cgroupPath, "cpu.max"), []byte(configStr), 0644); err != nil {
 			return errors.Wrap(err, "set cpu quota fail")
 		}
 	}
 
+	if rcfg.CpuRtPeriod != 0 || rcfg.CpuRtRuntime != 0 {
+		logrus.Warn("cpu realtime scheduling is not supported in cgroup v2, ignored")
+	}
+
 	return nil
 }
 
 func (cs *CpuSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuCfsQuota == 0 {
-		return nil
-	}
 	return applyCgroup(pid, cgroup)
 }
 
@@ -55,3 +66,23 @@ func (cs *CpuSubsystem) Remove(cgroup string) error {
 	}
 	return os.RemoveAll(cgroupPath)
 }
+
+// cgroup v2 的 cpu.stat 同时包含CPU用量与节流统计，单位为微秒
+func (cs *CpuSubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	values, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "cpu.stat"))
+	if err != nil {
+		return errors.Wrap(err, "read cpu.stat fail")
+	}
+	stats.Cpu.UsageNs = values["usage_usec"] * 1000
+	stats.Cpu.UserNs = values["user_usec"] * 1000
+	stats.Cpu.SystemNs = values["system_usec"] * 1000
+	stats.Cpu.NrPeriods = values["nr_periods"]
+	stats.Cpu.NrThrottled = values["nr_throttled"]
+	stats.Cpu.ThrottledTime = values["throttled_usec"] * 1000
+	return nil
+}
@@ -17,26 +17,30 @@ func (css *CpusetSubsystem) Name() string {
 }
 
 func (css *CpusetSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuSet == "" {
+	if rcfg.CpuSet == "" && rcfg.CpuSetMems == "" {
 		return nil
 	}
 
-	cgroupPath, err := getCgroupPath(cgroup, true)
+	cgroupPath, err := getControllerPath(cgroup, "cpuset")
 	if err != nil {
 		return err
 	}
 
-	if err = os.WriteFile(path.Join(cgroupPath, "cpuset.cpus"), []byte(rcfg.CpuSet), 0644); err != nil {
-		return errors.Wrap(err, "set cpuset fail")
+	if rcfg.CpuSet != "" {
+		if err = os.WriteFile(path.Join(cgroupPath, "cpuset.cpus"), []byte(rcfg.CpuSet), 0644); err != nil {
+			return errors.Wrap(err, "set cpuset fail")
+		}
+	}
+	if rcfg.CpuSetMems != "" {
+		if err = os.WriteFile(path.Join(cgroupPath, "cpuset.mems"), []byte(rcfg.CpuSetMems), 0644); err != nil {
+			return errors.Wrap(err, "set cpuset mems fail")
+		}
 	}
 
 	return nil
 }
 
 func (css *CpusetSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
-	if rcfg.CpuSet == "" {
-		return nil
-	}
 	return applyCgroup(pid, cgroup)
 }
 
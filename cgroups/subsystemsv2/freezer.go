@@ -0,0 +1,74 @@
+package subsystemsv2
+
+import (
+	"os"
+	"path"
+	"time"
+
+	"mydocker/cgroups/resource"
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
+)
+
+// 冻结或解冻时轮询 cgroup.events 的间隔与次数
+const (
+	freezeRetryInterval = 10 * time.Millisecond
+	freezeRetryTimes    = 1000
+)
+
+// cgroup v2 没有 freezer controller，通过 cgroup.freeze 冻结cgroup中的所有进程
+type FreezerSubsystem struct {
+}
+
+func (fs *FreezerSubsystem) Name() string {
+	return "freezer"
+}
+
+// freezer 不限制资源，只在 pause/unpause 时修改状态
+func (fs *FreezerSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	return nil
+}
+
+func (fs *FreezerSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	return applyCgroup(pid, cgroup)
+}
+
+func (fs *FreezerSubsystem) Remove(cgroup string) error {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(cgroupPath)
+}
+
+// 写入 cgroup.freeze 后，等待 cgroup.events 中的 frozen 字段与目标状态一致
+func (fs *FreezerSubsystem) Freeze(cgroup string, state resource.FreezerState) error {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	var want uint64
+	value := "0"
+	if state == resource.Frozen {
+		want = 1
+		value = "1"
+	}
+	if err = os.WriteFile(path.Join(cgroupPath, "cgroup.freeze"), []byte(value), 0644); err != nil {
+		return errors.Wrapf(err, "write %s to cgroup.freeze fail", value)
+	}
+
+	for i := 0; i < freezeRetryTimes; i++ {
+		events, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "cgroup.events"))
+		if err != nil {
+			return errors.Wrap(err, "read cgroup.events fail")
+		}
+		if events["frozen"] == want {
+			return nil
+		}
+		time.Sleep(freezeRetryInterval)
+	}
+
+	return errors.Errorf("wait for freezer state %s timeout", state)
+}
@@ -0,0 +1,51 @@
+package subsystemsv2
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"mydocker/cgroups/resource"
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
+)
+
+type HugetlbSubsystem struct {
+}
+
+func (hs *HugetlbSubsystem) Name() string {
+	return "hugetlb"
+}
+
+func (hs *HugetlbSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	if len(rcfg.HugetlbLimits) == 0 {
+		return nil
+	}
+
+	cgroupPath, err := getControllerPath(cgroup, "hugetlb")
+	if err != nil {
+		return err
+	}
+
+	for _, limit := range rcfg.HugetlbLimits {
+		file := fmt.Sprintf("hugetlb.%s.max", limit.PageSize)
+		if err = utils.WriteUint(path.Join(cgroupPath, file), limit.Limit); err != nil {
+			return errors.Wrapf(err, "set hugetlb limit of %s fail", limit.PageSize)
+		}
+	}
+
+	return nil
+}
+
+func (hs *HugetlbSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	return applyCgroup(pid, cgroup)
+}
+
+func (hs *HugetlbSubsystem) Remove(cgroup string) error {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(cgroupPath)
+}
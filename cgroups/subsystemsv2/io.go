@@ -0,0 +1,124 @@
+package subsystemsv2
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"mydocker/cgroups/resource"
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
+)
+
+// cgroup v2 中 blkio 被 io controller 取代
+type IoSubsystem struct {
+}
+
+func (is *IoSubsystem) Name() string {
+	return "io"
+}
+
+func (is *IoSubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
+	// io.max 中每个设备一行，各项限制可以分别写入, e.g., 8:0 rbps=1048576
+	throttles := map[string][]resource.ThrottleDevice{
+		"rbps":  rcfg.BlkioDeviceReadBps,
+		"wbps":  rcfg.BlkioDeviceWriteBps,
+		"riops": rcfg.BlkioDeviceReadIOps,
+		"wiops": rcfg.BlkioDeviceWriteIOps,
+	}
+	hasThrottle := false
+	for _, devices := range throttles {
+		hasThrottle = hasThrottle || len(devices) > 0
+	}
+	if rcfg.BlkioWeight == 0 && !hasThrottle {
+		return nil
+	}
+
+	cgroupPath, err := getControllerPath(cgroup, "io")
+	if err != nil {
+		return err
+	}
+
+	if rcfg.BlkioWeight != 0 {
+		if err = setIoWeight(cgroupPath, rcfg.BlkioWeight); err != nil {
+			return err
+		}
+	}
+
+	for key, devices := range throttles {
+		for _, device := range devices {
+			limit := fmt.Sprintf("%d:%d %s=%d", device.Major, device.Minor, key, device.Rate)
+			if err = os.WriteFile(path.Join(cgroupPath, "io.max"), []byte(limit), 0644); err != nil {
+				return errors.Wrapf(err, "set io.max %s of device %s fail", key, device.Path)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (is *IoSubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
+	return applyCgroup(pid, cgroup)
+}
+
+func (is *IoSubsystem) Remove(cgroup string) error {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(cgroupPath)
+}
+
+// io.weight 的范围为 1 ~ 10000，需要将 blkio weight 按比例换算；
+// 只有BFQ调度器时使用与 blkio 范围一致的 io.bfq.weight
+func setIoWeight(cgroupPath string, blkioWeight uint16) error {
+	weightFile := path.Join(cgroupPath, "io.weight")
+	weight := "default " + strconv.Itoa(1+(int(blkioWeight)-10)*9999/990)
+	if exist, _ := utils.PathExist(weightFile); !exist {
+		weightFile = path.Join(cgroupPath, "io.bfq.weight")
+		weight = strconv.Itoa(int(blkioWeight))
+	}
+	if err := os.WriteFile(weightFile, []byte(weight), 0644); err != nil {
+		return errors.Wrap(err, "set io weight fail")
+	}
+	return nil
+}
+
+// 从 io.stat 统计所有设备的读写字节数，其中每行的格式为 8:0 rbytes=4096 wbytes=0 rios=1 ...
+func (is *IoSubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(path.Join(cgroupPath, "io.stat"))
+	if err != nil {
+		return errors.Wrap(err, "read io.stat fail")
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "rbytes":
+				stats.Io.ReadBytes += v
+			case "wbytes":
+				stats.Io.WriteBytes += v
+			}
+		}
+	}
+	return nil
+}
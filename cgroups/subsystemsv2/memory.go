@@ -3,10 +3,14 @@ package subsystemsv2
 import (
 	"os"
 	"path"
+	"strconv"
+	"strings"
 
 	"mydocker/cgroups/resource"
+	"mydocker/utils"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type MemorySubsystem struct {
@@ -17,26 +21,53 @@ func (ms *MemorySubsystem) Name() string {
 }
 
 func (ms *MemorySubsystem) Set(cgroup string, rcfg *resource.ResourceConfig) error {
-	if rcfg.MemoryLimit == "" {
+	limits, err := rcfg.ParseMemory()
+	if err != nil {
+		return err
+	}
+	if *limits == (resource.MemoryLimits{}) && !rcfg.OomKillDisable {
 		return nil
 	}
 
-	cgroupPath, err := getCgroupPath(cgroup, true)
+	cgroupPath, err := getControllerPath(cgroup, "memory")
 	if err != nil {
 		return err
 	}
 
-	if err = os.WriteFile(path.Join(cgroupPath, "memory.max"), []byte(rcfg.MemoryLimit), 0644); err != nil {
-		return errors.Wrap(err, "set memory fail")
+	if limits.Limit != 0 {
+		if err = utils.WriteInt(path.Join(cgroupPath, "memory.max"), limits.Limit); err != nil {
+			return errors.Wrap(err, "set memory fail")
+		}
+	}
+
+	// memory.swap.max 只限制swap的用量，而 --memory-swap 为内存与swap的总量
+	if limits.Swap != 0 {
+		swap := "max"
+		if limits.Swap > 0 {
+			swap = strconv.FormatInt(limits.Swap-limits.Limit, 10)
+		}
+		if err = os.WriteFile(path.Join(cgroupPath, "memory.swap.max"), []byte(swap), 0644); err != nil {
+			return errors.Wrap(err, "set memory swap fail")
+		}
+	}
+
+	if limits.Reservation != 0 {
+		if err = utils.WriteInt(path.Join(cgroupPath, "memory.low"), limits.Reservation); err != nil {
+			return errors.Wrap(err, "set memory reservation fail")
+		}
+	}
+
+	if limits.Kernel != 0 {
+		logrus.Warn("kernel memory limit is not supported in cgroup v2, ignored")
+	}
+	if rcfg.OomKillDisable {
+		logrus.Warn("disabling oom killer is not supported in cgroup v2, ignored")
 	}
 
 	return nil
 }
 
 func (ms *MemorySubsystem) Apply(cgroup string, pid int, rcfg *resource.ResourceConfig) error {
-	if rcfg.MemoryLimit == "" {
-		return nil
-	}
 	return applyCgroup(pid, cgroup)
 }
 
@@ -48,3 +79,51 @@ func (ms *MemorySubsystem) Remove(cgroup string) error {
 
 	return os.RemoveAll(cgroupPath)
 }
+
+// 读取cgroup中因OOM被杀死的进程数
+func (ms *MemorySubsystem) OOMKillCount(cgroup string) (uint64, error) {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return 0, err
+	}
+
+	values, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "memory.events"))
+	if err != nil {
+		return 0, errors.Wrap(err, "read memory.events fail")
+	}
+	return values["oom_kill"], nil
+}
+
+func (ms *MemorySubsystem) Usage(cgroup string) (uint64, error) {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return 0, err
+	}
+	return utils.ReadUint(path.Join(cgroupPath, "memory.current"))
+}
+
+func (ms *MemorySubsystem) GetStats(cgroup string, stats *resource.Stats) error {
+	cgroupPath, err := getCgroupPath(cgroup, false)
+	if err != nil {
+		return err
+	}
+
+	if stats.Memory.Usage, err = ms.Usage(cgroup); err != nil {
+		return err
+	}
+	// 旧内核中没有 memory.peak
+	stats.Memory.Peak, _ = utils.ReadUint(path.Join(cgroupPath, "memory.peak"))
+	// 未限制时 memory.max 为 max
+	limit, err := os.ReadFile(path.Join(cgroupPath, "memory.max"))
+	if err != nil {
+		return errors.Wrap(err, "read memory.max fail")
+	}
+	stats.Memory.Limit, _ = strconv.ParseUint(strings.TrimSpace(string(limit)), 10, 64)
+
+	values, err := utils.ParseKeyValueFile(path.Join(cgroupPath, "memory.stat"))
+	if err != nil {
+		return errors.Wrap(err, "read memory.stat fail")
+	}
+	stats.Memory.Cache = values["file"]
+	return nil
+}
@@ -8,4 +8,8 @@ var SubsystemSet = []resource.Subsystem{
 	&CpuSubsystem{},
 	&CpusetSubsystem{},
 	&MemorySubsystem{},
+	&PidsSubsystem{},
+	&IoSubsystem{},
+	&HugetlbSubsystem{},
+	&FreezerSubsystem{},
 }
@@ -1,12 +1,13 @@
 package subsystemsv2
 
 import (
-	"mydocker/utils"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 const unifiedCgroupPath = "/sys/fs/cgroup"
@@ -21,18 +22,65 @@ func getCgroupPath(cgroup string, autoCreate bool) (string, error) {
 	_, err := os.Stat(cgroupPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			err = os.MkdirAll(cgroupPath, 0755)
-			return cgroupPath, err
+			if err = os.MkdirAll(cgroupPath, 0755); err != nil {
+				return cgroupPath, err
+			}
+			return cgroupPath, enableControllers(cgroup)
 		}
 	}
 
 	return cgroupPath, errors.Wrap(err, "unknown file stat")
 }
 
+// cgroup v2 中子cgroup能使用的controller由父cgroup的 cgroup.subtree_control 决定，
+// 因此需要从根cgroup开始，在 mydocker/{containerID} 的每一级父cgroup中开启可用的controller
+func enableControllers(cgroup string) error {
+	parent := unifiedCgroupPath
+	dirs := strings.Split(strings.Trim(cgroup, "/"), "/")
+	for _, dir := range dirs {
+		content, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+		if err != nil {
+			return errors.Wrapf(err, "read controllers of %s failed", parent)
+		}
+		// 部分controller可能无法开启，e.g., 父cgroup中有进程时受 no internal processes 规则限制
+		// 逐个开启并记录失败的controller，资源限制实际需要的controller由 getControllerPath 检查
+		var failed []string
+		for _, controller := range strings.Fields(string(content)) {
+			if err = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+"+controller), 0644); err != nil {
+				failed = append(failed, controller)
+			}
+		}
+		if len(failed) > 0 {
+			logrus.Warnf("enable controllers %s in %s failed", strings.Join(failed, ","), parent)
+		}
+		parent = filepath.Join(parent, dir)
+	}
+	return nil
+}
+
+// 创建 cgroup 并检查资源限制需要的controller是否已在其中开启
+// 未开启时 cpu.max 等接口文件不存在，直接返回错误说明原因
+func getControllerPath(cgroup, controller string) (string, error) {
+	cgroupPath, err := getCgroupPath(cgroup, true)
+	if err != nil {
+		return cgroupPath, err
+	}
+	content, err := os.ReadFile(filepath.Join(cgroupPath, "cgroup.controllers"))
+	if err != nil {
+		return cgroupPath, errors.Wrapf(err, "read controllers of %s failed", cgroupPath)
+	}
+	for _, enabled := range strings.Fields(string(content)) {
+		if enabled == controller {
+			return cgroupPath, nil
+		}
+	}
+	return cgroupPath, errors.Errorf("%s controller is not enabled in %s, check cgroup.subtree_control of its parent cgroups", controller, cgroupPath)
+}
+
 func applyCgroup(pid int, cgroup string) error {
-	cgroupPath := filepath.Join(unifiedCgroupPath, cgroup)
-	if exist, err := utils.PathExist(cgroupPath); !exist {
-		return errors.Wrapf(err, "cgroup [%s] not exists", cgroup)
+	cgroupPath, err := getCgroupPath(cgroup, true)
+	if err != nil {
+		return errors.Wrapf(err, "get cgroup [%s] failed", cgroup)
 	}
 
 	if err := os.WriteFile(filepath.Join(cgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
@@ -40,3 +88,13 @@ func applyCgroup(pid int, cgroup string) error {
 	}
 	return nil
 }
+
+// 创建 cgroup 并开启父cgroup中可用的controller，返回其绝对路径
+func CreateCgroup(cgroup string) (string, error) {
+	return getCgroupPath(cgroup, true)
+}
+
+// 获取 cgroup 的绝对路径，不会自动创建
+func CgroupPath(cgroup string) string {
+	return filepath.Join(unifiedCgroupPath, cgroup)
+}
@@ -0,0 +1,223 @@
+package cgroups
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path"
+
+	"mydocker/cgroups/resource"
+	"mydocker/cgroups/subsystemsv2"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+	"github.com/pkg/errors"
+)
+
+// 由 systemd 管理容器cgroup，容器进程运行在 transient scope 中
+// scope 的创建与销毁交给 systemd，scope 创建并委派(Delegate)给容器后，
+// systemd 不支持的资源限制(cpuset、hugetlb、IO节流等)以及统计、冻结仍通过 cgroupfs 读写
+type SystemdManager struct {
+	// scope 创建后通过 cgroupfs 读写cgroup，默认为 CgroupManagerV2
+	CgroupManager
+	// cgroup 的相对路径
+	Path string
+	// scope 创建前设置的资源限制
+	Resource *resource.ResourceConfig
+	// scope 所在的 slice, e.g., system.slice
+	Slice string
+	// scope 的 unit 名, e.g., mydocker-{containerID}.scope
+	Unit string
+}
+
+func NewSystemdManager(path string) *SystemdManager {
+	slice, unit := splitScopePath(path)
+	return &SystemdManager{
+		CgroupManager: NewCgroupManagerV2(path),
+		Path:          path,
+		Slice:         slice,
+		Unit:          unit,
+	}
+}
+
+// cgroup 路径中最后一级为 scope，其父目录为 slice
+func splitScopePath(cgroupPath string) (string, string) {
+	return path.Base(path.Dir(cgroupPath)), path.Base(cgroupPath)
+}
+
+// SystemdManager 用到的 systemd D-Bus 接口，由 *systemdDbus.Conn 实现
+type systemdConn interface {
+	StartTransientUnitContext(ctx context.Context, name string, mode string, properties []systemdDbus.Property, ch chan<- string) (int, error)
+	StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error)
+	SetUnitPropertiesContext(ctx context.Context, name string, runtime bool, properties ...systemdDbus.Property) error
+	Close()
+}
+
+// 连接 systemd，测试中替换为不依赖 systemd 的实现
+// 通过 DBUS_SYSTEM_BUS_ADDRESS 可以连接到指定的 system bus
+var newSystemdConn = func(ctx context.Context) (systemdConn, error) {
+	conn, err := systemdDbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "connect to systemd over dbus failed")
+	}
+	return conn, nil
+}
+
+// scope 只能在有进程加入时由 Apply 创建，创建前的资源限制会在 Apply 时一并设置
+func (m *SystemdManager) Set(res *resource.ResourceConfig) error {
+	if _, err := os.Stat(subsystemsv2.CgroupPath(m.Path)); os.IsNotExist(err) {
+		m.Resource = res
+		return nil
+	}
+
+	if err := m.CgroupManager.Set(res); err != nil {
+		return err
+	}
+
+	// 同步更新 unit 属性，否则 systemd reload 时会用旧的属性覆盖 cgroup 中的限制
+	properties, err := unitResourceProperties(res)
+	if err != nil || len(properties) == 0 {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), systemdTimeout)
+	defer cancel()
+	conn, err := newSystemdConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetUnitPropertiesContext(ctx, m.Unit, true, properties...); err != nil {
+		return errors.Wrapf(err, "set properties of unit %s failed", m.Unit)
+	}
+	return nil
+}
+
+// 创建包含容器进程的 transient scope，再通过 cgroupfs 设置 systemd 不支持的资源限制
+func (m *SystemdManager) Apply(pid int, res *resource.ResourceConfig) error {
+	properties := []systemdDbus.Property{
+		systemdDbus.PropDescription("mydocker container " + m.Unit),
+		systemdDbus.PropSlice(m.Slice),
+		systemdDbus.PropPids(uint32(pid)),
+		// 将 scope 委派给容器，systemd 不再改动 scope 内的cgroup文件
+		newProperty("Delegate", true),
+		newProperty("MemoryAccounting", true),
+		newProperty("CPUAccounting", true),
+		newProperty("TasksAccounting", true),
+		newProperty("IOAccounting", true),
+	}
+	limits, err := unitResourceProperties(res)
+	if err != nil {
+		return err
+	}
+	properties = append(properties, limits...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdTimeout)
+	defer cancel()
+	conn, err := newSystemdConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch := make(chan string, 1)
+	if _, err = conn.StartTransientUnitContext(ctx, m.Unit, "replace", properties, ch); err != nil {
+		// 上一次运行的scope可能还未被回收，此时直接将进程加入其中
+		if !isDbusError(err, "org.freedesktop.systemd1.UnitExists") {
+			return errors.Wrapf(err, "start transient unit %s failed", m.Unit)
+		}
+		if err = m.CgroupManager.Apply(pid, res); err != nil {
+			return err
+		}
+	} else if err = waitJob(ctx, ch); err != nil {
+		return errors.WithMessagef(err, "start transient unit %s failed", m.Unit)
+	}
+
+	return m.CgroupManager.Set(res)
+}
+
+// 停止 scope 后由 systemd 删除对应的cgroup
+func (m *SystemdManager) Destroy() error {
+	ctx, cancel := context.WithTimeout(context.Background(), systemdTimeout)
+	defer cancel()
+	conn, err := newSystemdConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch := make(chan string, 1)
+	if _, err = conn.StopUnitContext(ctx, m.Unit, "replace", ch); err != nil {
+		if !isDbusError(err, "org.freedesktop.systemd1.NoSuchUnit") {
+			return errors.Wrapf(err, "stop unit %s failed", m.Unit)
+		}
+	} else if err = waitJob(ctx, ch); err != nil {
+		return errors.WithMessagef(err, "stop unit %s failed", m.Unit)
+	}
+
+	return m.CgroupManager.Destroy()
+}
+
+// 将资源限制转换为 systemd unit 的属性，其余限制直接写入cgroup
+func unitResourceProperties(res *resource.ResourceConfig) ([]systemdDbus.Property, error) {
+	var properties []systemdDbus.Property
+	if res == nil {
+		return properties, nil
+	}
+
+	limits, err := res.ParseMemory()
+	if err != nil {
+		return nil, err
+	}
+	if limits.Limit > 0 {
+		properties = append(properties, newProperty("MemoryMax", uint64(limits.Limit)))
+	}
+
+	quota, period := res.CpuQuotaAndPeriod()
+	if quota > 0 {
+		// systemd 以每秒可用的CPU时间表示 quota，向上取整到 10ms
+		quotaPerSec := uint64(quota) * 1000000 / period
+		if quotaPerSec%10000 != 0 {
+			quotaPerSec = (quotaPerSec/10000 + 1) * 10000
+		}
+		properties = append(properties, newProperty("CPUQuotaPerSecUSec", quotaPerSec))
+	}
+	if res.CpuShares != 0 {
+		properties = append(properties, newProperty("CPUWeight", resource.ConvertCpuSharesToWeight(res.CpuShares)))
+	}
+
+	if res.PidsLimit > 0 {
+		properties = append(properties, newProperty("TasksMax", uint64(res.PidsLimit)))
+	} else if res.PidsLimit == -1 {
+		properties = append(properties, newProperty("TasksMax", uint64(math.MaxUint64)))
+	}
+	return properties, nil
+}
+
+func newProperty(name string, value interface{}) systemdDbus.Property {
+	return systemdDbus.Property{
+		Name:  name,
+		Value: dbus.MakeVariant(value),
+	}
+}
+
+// 等待 systemd job 执行完毕
+func waitJob(ctx context.Context, ch <-chan string) error {
+	select {
+	case result := <-ch:
+		if result != "done" {
+			return fmt.Errorf("job result is %s", result)
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "wait for systemd job failed")
+	}
+}
+
+func isDbusError(err error, name string) bool {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) {
+		return dbusErr.Name == name
+	}
+	return false
+}
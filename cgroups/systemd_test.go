@@ -0,0 +1,255 @@
+package cgroups
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"mydocker/cgroups/resource"
+
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+)
+
+// 记录调用并返回预设错误的 systemd 连接
+type fakeSystemdConn struct {
+	startErr   error
+	stopErr    error
+	started    []string
+	stopped    []string
+	properties []systemdDbus.Property
+}
+
+func (c *fakeSystemdConn) StartTransientUnitContext(ctx context.Context, name string, mode string, properties []systemdDbus.Property, ch chan<- string) (int, error) {
+	c.started = append(c.started, name)
+	c.properties = properties
+	if c.startErr != nil {
+		return 0, c.startErr
+	}
+	ch <- "done"
+	return 1, nil
+}
+
+func (c *fakeSystemdConn) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	c.stopped = append(c.stopped, name)
+	if c.stopErr != nil {
+		return 0, c.stopErr
+	}
+	ch <- "done"
+	return 1, nil
+}
+
+func (c *fakeSystemdConn) SetUnitPropertiesContext(ctx context.Context, name string, runtime bool, properties ...systemdDbus.Property) error {
+	return nil
+}
+
+func (c *fakeSystemdConn) Close() {}
+
+// 不读写 cgroupfs 的 CgroupManager，只记录调用
+type fakeCgroupManager struct {
+	CgroupManager
+	appliedPid int
+	setCalls   int
+	destroyed  bool
+}
+
+func (m *fakeCgroupManager) Apply(pid int, res *resource.ResourceConfig) error {
+	m.appliedPid = pid
+	return nil
+}
+
+func (m *fakeCgroupManager) Set(res *resource.ResourceConfig) error {
+	m.setCalls++
+	return nil
+}
+
+func (m *fakeCgroupManager) Destroy() error {
+	m.destroyed = true
+	return nil
+}
+
+func useFakeSystemdConn(t *testing.T, conn *fakeSystemdConn, err error) {
+	orig := newSystemdConn
+	newSystemdConn = func(ctx context.Context) (systemdConn, error) {
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+	t.Cleanup(func() { newSystemdConn = orig })
+}
+
+func newFakeSystemdManager() (*SystemdManager, *fakeCgroupManager) {
+	fs := &fakeCgroupManager{}
+	m := NewSystemdManager("system.slice/mydocker-0123456789.scope")
+	m.CgroupManager = fs
+	return m, fs
+}
+
+func findProperty(properties []systemdDbus.Property, name string) (interface{}, bool) {
+	for _, p := range properties {
+		if p.Name == name {
+			return p.Value.Value(), true
+		}
+	}
+	return nil, false
+}
+
+func TestUnitResourceProperties(t *testing.T) {
+	tests := []struct {
+		name     string
+		res      *resource.ResourceConfig
+		property string
+		want     uint64
+	}{
+		{"quota rounded up to 10ms", &resource.ResourceConfig{CpuQuota: 15001}, "CPUQuotaPerSecUSec", 160000},
+		{"quota with period", &resource.ResourceConfig{CpuQuota: 50000, CpuPeriod: 200000}, "CPUQuotaPerSecUSec", 250000},
+		{"quota in percent", &resource.ResourceConfig{CpuCfsQuota: 50}, "CPUQuotaPerSecUSec", 500000},
+		{"unlimited pids", &resource.ResourceConfig{PidsLimit: -1}, "TasksMax", math.MaxUint64},
+		{"pids limit", &resource.ResourceConfig{PidsLimit: 100}, "TasksMax", 100},
+		{"default shares", &resource.ResourceConfig{CpuShares: 1024}, "CPUWeight", 39},
+		{"min shares", &resource.ResourceConfig{CpuShares: resource.MinCpuShares}, "CPUWeight", 1},
+		{"max shares", &resource.ResourceConfig{CpuShares: resource.MaxCpuShares}, "CPUWeight", 10000},
+		{"memory", &resource.ResourceConfig{MemoryLimit: "100m"}, "MemoryMax", 100 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			properties, err := unitResourceProperties(tt.res)
+			if err != nil {
+				t.Fatalf("unitResourceProperties: %v", err)
+			}
+			value, ok := findProperty(properties, tt.property)
+			if !ok {
+				t.Fatalf("property %s not set, got %v", tt.property, properties)
+			}
+			if value != tt.want {
+				t.Errorf("%s = %v, want %d", tt.property, value, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnitResourcePropertiesEmpty(t *testing.T) {
+	for _, res := range []*resource.ResourceConfig{nil, {}} {
+		properties, err := unitResourceProperties(res)
+		if err != nil {
+			t.Fatalf("unitResourceProperties: %v", err)
+		}
+		if len(properties) != 0 {
+			t.Errorf("unitResourceProperties(%v) = %v, want no properties", res, properties)
+		}
+	}
+}
+
+func TestSystemdApply(t *testing.T) {
+	conn := &fakeSystemdConn{}
+	useFakeSystemdConn(t, conn, nil)
+	m, fs := newFakeSystemdManager()
+
+	if err := m.Apply(1234, &resource.ResourceConfig{PidsLimit: 10}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(conn.started) != 1 || conn.started[0] != m.Unit {
+		t.Errorf("started units = %v, want [%s]", conn.started, m.Unit)
+	}
+	if value, ok := findProperty(conn.properties, "Slice"); !ok || value != "system.slice" {
+		t.Errorf("Slice = %v, want system.slice", value)
+	}
+	if value, ok := findProperty(conn.properties, "TasksMax"); !ok || value != uint64(10) {
+		t.Errorf("TasksMax = %v, want 10", value)
+	}
+	// scope 由 systemd 创建，进程不需要再通过 cgroupfs 加入
+	if fs.appliedPid != 0 {
+		t.Errorf("cgroupfs Apply called with pid %d", fs.appliedPid)
+	}
+	if fs.setCalls != 1 {
+		t.Errorf("cgroupfs Set called %d times, want 1", fs.setCalls)
+	}
+}
+
+func TestSystemdApplyUnitExists(t *testing.T) {
+	conn := &fakeSystemdConn{startErr: dbus.Error{Name: "org.freedesktop.systemd1.UnitExists"}}
+	useFakeSystemdConn(t, conn, nil)
+	m, fs := newFakeSystemdManager()
+
+	if err := m.Apply(1234, &resource.ResourceConfig{}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if fs.appliedPid != 1234 {
+		t.Errorf("cgroupfs Apply pid = %d, want 1234", fs.appliedPid)
+	}
+	if fs.setCalls != 1 {
+		t.Errorf("cgroupfs Set called %d times, want 1", fs.setCalls)
+	}
+}
+
+func TestSystemdApplyStartFailed(t *testing.T) {
+	conn := &fakeSystemdConn{startErr: dbus.Error{Name: "org.freedesktop.systemd1.UnitMasked"}}
+	useFakeSystemdConn(t, conn, nil)
+	m, fs := newFakeSystemdManager()
+
+	if err := m.Apply(1234, &resource.ResourceConfig{}); err == nil {
+		t.Fatal("Apply succeeded, want error")
+	}
+	if fs.appliedPid != 0 || fs.setCalls != 0 {
+		t.Errorf("cgroupfs used after start failed, pid %d, set %d", fs.appliedPid, fs.setCalls)
+	}
+}
+
+func TestSystemdDestroyNoSuchUnit(t *testing.T) {
+	conn := &fakeSystemdConn{stopErr: dbus.Error{Name: "org.freedesktop.systemd1.NoSuchUnit"}}
+	useFakeSystemdConn(t, conn, nil)
+	m, fs := newFakeSystemdManager()
+
+	if err := m.Destroy(); err != nil {
+		t.Fatalf("Destroy: %v", err)
+	}
+	if len(conn.stopped) != 1 || conn.stopped[0] != m.Unit {
+		t.Errorf("stopped units = %v, want [%s]", conn.stopped, m.Unit)
+	}
+	if !fs.destroyed {
+		t.Error("cgroupfs Destroy not called")
+	}
+}
+
+func TestSystemdDestroyStopFailed(t *testing.T) {
+	conn := &fakeSystemdConn{stopErr: dbus.Error{Name: "org.freedesktop.DBus.Error.AccessDenied"}}
+	useFakeSystemdConn(t, conn, nil)
+	m, fs := newFakeSystemdManager()
+
+	if err := m.Destroy(); err == nil {
+		t.Fatal("Destroy succeeded, want error")
+	}
+	if fs.destroyed {
+		t.Error("cgroupfs Destroy called after stop failed")
+	}
+}
+
+func TestResolveDriver(t *testing.T) {
+	useFakeSystemdConn(t, nil, errors.New("no system bus"))
+
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"", DriverCgroupfs},
+		{DriverCgroupfs, DriverCgroupfs},
+		// 无法连接 systemd 或宿主机为 cgroup v1 时都回退到 cgroupfs
+		{DriverSystemd, DriverCgroupfs},
+	}
+	for _, tt := range tests {
+		got, err := ResolveDriver(tt.driver)
+		if err != nil {
+			t.Errorf("ResolveDriver(%q): %v", tt.driver, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveDriver(%q) = %s, want %s", tt.driver, got, tt.want)
+		}
+	}
+
+	if _, err := ResolveDriver("unknown"); err == nil {
+		t.Error("ResolveDriver(unknown) succeeded, want error")
+	}
+}
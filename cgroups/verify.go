@@ -14,7 +14,8 @@ var (
 	isUnified bool
 )
 
-func isUnifiedCgroup() bool {
+// 宿主机是否只挂载了 cgroup v2
+func IsUnifiedCgroup() bool {
 	once.Do(func() {
 		var st unix.Statfs_t
 		err := unix.Statfs(unifiedMountPoint, &st)
@@ -0,0 +1,124 @@
+package container
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// 监控进程为每个容器监听的 attach socket
+const AttachSocketName = "attach.sock"
+
+// attach 客户端与监控进程之间通信的数据帧类型
+// 每个数据帧由 1 字节类型、4 字节长度与数据组成
+const (
+	frameStdin  byte = iota + 1 // 客户端输入，写入容器的标准输入
+	frameStdout                 // 容器的标准输出，使用伪终端时包括标准错误
+	frameStderr                 // 容器的标准错误
+	frameResize                 // 客户端终端的窗口大小，rows 与 cols 各 2 字节
+	frameExit                   // 容器退出，数据为 4 字节的退出码
+)
+
+// 单个数据帧的最大长度
+const maxFrameSize = 1 << 20
+
+// 监控进程在容器退出前断开了连接
+var ErrAttachClosed = errors.New("attach connection closed before container exited")
+
+func AttachSocketPath(containerID string) string {
+	return filepath.Join(InfoLoc, containerID, AttachSocketName)
+}
+
+func encodeFrame(typ byte, data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	frame[0] = typ
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
+}
+
+func readFrame(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:5])
+	if size > maxFrameSize {
+		return 0, nil, errors.Errorf("frame size %d exceeds limit", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return header[0], data, nil
+}
+
+// 与容器监控进程之间的 attach 连接
+type AttachConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+// 连接容器监控进程的 attach socket
+func DialAttach(containerID string) (*AttachConn, error) {
+	conn, err := net.Dial("unix", AttachSocketPath(containerID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect to container %s failed", containerID)
+	}
+	return &AttachConn{conn: conn}, nil
+}
+
+func (c *AttachConn) writeFrame(typ byte, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(encodeFrame(typ, data))
+	return err
+}
+
+// 写入容器的标准输入
+func (c *AttachConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(frameStdin, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// 调整容器伪终端的窗口大小
+func (c *AttachConn) Resize(rows, cols uint16) error {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:2], rows)
+	binary.BigEndian.PutUint16(data[2:4], cols)
+	return c.writeFrame(frameResize, data)
+}
+
+// 将容器的输出写入 stdout 与 stderr，阻塞直到容器退出并返回其退出码
+func (c *AttachConn) Receive(stdout, stderr io.Writer) (int, error) {
+	for {
+		typ, data, err := readFrame(c.conn)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return -1, ErrAttachClosed
+			}
+			return -1, errors.Wrap(err, "read from attach connection failed")
+		}
+		switch typ {
+		case frameStdout:
+			_, _ = stdout.Write(data)
+		case frameStderr:
+			_, _ = stderr.Write(data)
+		case frameExit:
+			if len(data) != 4 {
+				return -1, errors.New("invalid exit frame")
+			}
+			return int(int32(binary.BigEndian.Uint32(data))), nil
+		}
+	}
+}
+
+func (c *AttachConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,387 @@
+package container
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// 每个客户端待发送的帧数，客户端读取过慢导致队列写满时断开该客户端，避免阻塞容器输出
+	clientQueueSize = 256
+	// 等待第一个客户端时最多保留的输出
+	maxHeldOutput = 1 << 20
+	// 关闭时等待客户端接收剩余输出的时间
+	closeTimeout = 5 * time.Second
+)
+
+// 容器进程的标准输入输出，由 ConsoleServer 为每次启动创建
+type Stdio struct {
+	Stdin  *os.File // 为 nil 时容器的标准输入为 /dev/null
+	Stdout *os.File
+	Stderr *os.File
+	// 使用伪终端时为 slave 端在宿主机上的路径，Stdin、Stdout 与 Stderr 均为该 slave 端
+	Console string
+}
+
+// 关闭监控进程持有的子进程端，需要在容器进程启动后调用
+func (s *Stdio) Close() {
+	closed := make(map[*os.File]bool)
+	for _, f := range []*os.File{s.Stdin, s.Stdout, s.Stderr} {
+		if f != nil && !closed[f] {
+			closed[f] = true
+			_ = f.Close()
+		}
+	}
+}
+
+type consoleClient struct {
+	conn    net.Conn
+	queue   chan []byte
+	pending [][]byte
+	// 容器退出时设置，队列中的输出全部发送后再发送，不受队列容量限制
+	exit   []byte
+	closed bool
+}
+
+// 监控进程持有容器的标准输入输出，将输出写入日志文件并转发给所有 attach 的客户端
+type ConsoleServer struct {
+	tty       bool
+	openStdin bool
+	listener  net.Listener
+	logFile   *os.File
+
+	mu      sync.Mutex
+	clients map[*consoleClient]bool
+	stdin   io.WriteCloser
+	master  *os.File
+	size    *pty.Winsize
+	// 前台运行的容器在第一个客户端连接前保留输出，避免丢失容器启动时的输出
+	hold    bool
+	held    [][]byte
+	heldLen int
+	// 第一个客户端连接时关闭
+	attached chan struct{}
+	// 容器不再重启时的退出帧，之后连接的客户端收到保留的输出后也会收到
+	exit []byte
+
+	pumps   sync.WaitGroup
+	writers sync.WaitGroup
+}
+
+// 打开容器的日志文件并监听 attach socket
+// hold 为 true 时，第一个客户端连接前的输出会在连接后发送给它
+func NewConsoleServer(info *Info, hold bool) (*ConsoleServer, error) {
+	logFile, err := openLogFile(info.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	socketPath := AttachSocketPath(info.Id)
+	_ = os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		logFile.Close()
+		return nil, errors.Wrapf(err, "listen on %s failed", socketPath)
+	}
+
+	s := &ConsoleServer{
+		tty:       info.Tty,
+		openStdin: info.OpenStdin,
+		listener:  listener,
+		logFile:   logFile,
+		clients:   make(map[*consoleClient]bool),
+		hold:      hold,
+		attached:  make(chan struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// 重新start的容器继续追加写入原有日志
+func openLogFile(containerID string) (*os.File, error) {
+	dirPath := filepath.Join(InfoLoc, containerID)
+	if err := os.MkdirAll(dirPath, 0622); err != nil {
+		return nil, errors.Wrapf(err, "mkdir %s failed", dirPath)
+	}
+	logFilePath := filepath.Join(dirPath, GetLogFile(containerID))
+	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create log file %s failed", logFilePath)
+	}
+	return logFile, nil
+}
+
+// 为容器的一次启动创建标准输入输出，并开始转发容器的输出
+// 使用伪终端时 master 端由监控进程持有，否则标准输出与标准错误分别使用一个Pipe
+func (s *ConsoleServer) NewStdio() (*Stdio, error) {
+	if s.tty {
+		master, slave, err := pty.Open()
+		if err != nil {
+			return nil, errors.Wrap(err, "allocate pty failed")
+		}
+		s.mu.Lock()
+		s.stdin = master
+		s.master = master
+		if s.size != nil {
+			_ = pty.Setsize(master, s.size)
+		}
+		s.mu.Unlock()
+
+		s.pumps.Add(1)
+		go s.pump(master, frameStdout)
+		return &Stdio{Stdin: slave, Stdout: slave, Stderr: slave, Console: slave.Name()}, nil
+	}
+
+	stdio := new(Stdio)
+	var readers []*os.File
+	for _, f := range []**os.File{&stdio.Stdout, &stdio.Stderr} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			stdio.Close()
+			for _, r := range readers {
+				r.Close()
+			}
+			return nil, errors.Wrap(err, "create output pipe failed")
+		}
+		readers = append(readers, r)
+		*f = w
+	}
+	if s.openStdin {
+		r, w, err := os.Pipe()
+		if err != nil {
+			stdio.Close()
+			for _, r := range readers {
+				r.Close()
+			}
+			return nil, errors.Wrap(err, "create input pipe failed")
+		}
+		stdio.Stdin = r
+		s.mu.Lock()
+		s.stdin = w
+		s.mu.Unlock()
+	}
+
+	s.pumps.Add(2)
+	go s.pump(readers[0], frameStdout)
+	go s.pump(readers[1], frameStderr)
+	return stdio, nil
+}
+
+// 读取容器输出写入日志文件，并转发给客户端
+// 子进程端全部关闭后读取会返回 EOF，伪终端的 master 端则返回 EIO
+func (s *ConsoleServer) pump(r *os.File, typ byte) {
+	defer s.pumps.Done()
+	defer r.Close()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := s.logFile.Write(buf[:n]); err != nil {
+				log.Warnf("write container log failed, %v", err)
+			}
+			s.broadcast(encodeFrame(typ, buf[:n]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// 等待本次启动的输出转发完成，并关闭容器的标准输入，需要在容器进程退出后调用
+func (s *ConsoleServer) WaitOutput() {
+	s.pumps.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stdin != nil && !s.tty {
+		_ = s.stdin.Close()
+	}
+	s.stdin = nil
+	s.master = nil
+}
+
+func (s *ConsoleServer) broadcast(frame []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hold {
+		if s.heldLen+len(frame) <= maxHeldOutput {
+			s.held = append(s.held, frame)
+			s.heldLen += len(frame)
+		}
+		return
+	}
+	for client := range s.clients {
+		select {
+		case client.queue <- frame:
+		default:
+			log.Warnf("attach client is too slow, disconnect it")
+			s.removeClient(client)
+		}
+	}
+}
+
+// 容器不再重启时通知所有客户端退出码并断开连接
+func (s *ConsoleServer) Exit(code int) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(int32(code)))
+	frame := encodeFrame(frameExit, data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exit = frame
+	for client := range s.clients {
+		client.exit = frame
+		s.removeClient(client)
+	}
+}
+
+// 停止监听并删除 socket，等待客户端接收完剩余的输出
+// 前台运行的容器在 CLI 连接前就已退出时，等待 CLI 连接并接收保留的输出与退出码
+func (s *ConsoleServer) Close() {
+	s.mu.Lock()
+	waitAttach := s.hold && s.exit != nil
+	s.mu.Unlock()
+	if waitAttach {
+		select {
+		case <-s.attached:
+		case <-time.After(closeTimeout):
+			log.Warnf("no client attached in %v, discard the output", closeTimeout)
+		}
+	}
+
+	_ = s.listener.Close()
+	_ = os.Remove(s.listener.Addr().String())
+
+	s.mu.Lock()
+	for client := range s.clients {
+		_ = client.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+		s.removeClient(client)
+	}
+	s.mu.Unlock()
+
+	s.writers.Wait()
+	_ = s.logFile.Close()
+}
+
+// 需要持有 s.mu
+func (s *ConsoleServer) removeClient(client *consoleClient) {
+	if client.closed {
+		return
+	}
+	client.closed = true
+	delete(s.clients, client)
+	close(client.queue)
+}
+
+func (s *ConsoleServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		client := &consoleClient{
+			conn:  conn,
+			queue: make(chan []byte, clientQueueSize),
+		}
+		s.mu.Lock()
+		if s.hold {
+			client.pending = s.held
+			s.hold = false
+			s.held = nil
+			close(s.attached)
+		}
+		s.clients[client] = true
+		// 容器已经退出，发送完剩余输出后发送退出帧并断开
+		if s.exit != nil {
+			client.exit = s.exit
+			s.removeClient(client)
+		}
+		s.mu.Unlock()
+
+		s.writers.Add(1)
+		go s.writeClient(client)
+		go s.readClient(client)
+	}
+}
+
+// 按顺序向客户端发送输出，队列关闭后断开连接
+func (s *ConsoleServer) writeClient(client *consoleClient) {
+	defer s.writers.Done()
+	defer client.conn.Close()
+
+	for _, frame := range client.pending {
+		if _, err := client.conn.Write(frame); err != nil {
+			s.dropClient(client)
+			return
+		}
+	}
+	client.pending = nil
+	for frame := range client.queue {
+		if _, err := client.conn.Write(frame); err != nil {
+			s.dropClient(client)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	exit := client.exit
+	s.mu.Unlock()
+	if exit != nil {
+		_, _ = client.conn.Write(exit)
+	}
+}
+
+// 读取客户端的输入与窗口大小，客户端断开后不再向其发送输出
+func (s *ConsoleServer) readClient(client *consoleClient) {
+	defer s.dropClient(client)
+
+	for {
+		typ, data, err := readFrame(client.conn)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case frameStdin:
+			s.mu.Lock()
+			stdin := s.stdin
+			s.mu.Unlock()
+			if stdin == nil {
+				continue
+			}
+			if _, err = stdin.Write(data); err != nil {
+				log.Warnf("write container stdin failed, %v", err)
+			}
+		case frameResize:
+			if len(data) != 4 {
+				continue
+			}
+			size := &pty.Winsize{
+				Rows: binary.BigEndian.Uint16(data[0:2]),
+				Cols: binary.BigEndian.Uint16(data[2:4]),
+			}
+			s.mu.Lock()
+			s.size = size
+			if s.master != nil {
+				_ = pty.Setsize(s.master, size)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *ConsoleServer) dropClient(client *consoleClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeClient(client)
+}
@@ -0,0 +1,109 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// exec 可以进入的namespace，mnt 需要最后进入
+var ExecNamespaces = []string{"cgroup", "ipc", "uts", "net", "pid", "mnt"}
+
+// exec 进程的启动配置，以JSON的格式通过Pipe传递
+type ExecSpec struct {
+	Args []string `json:"args"` // 用户命令及参数
+	Env  []string `json:"env"`  // 命令的环境变量，不继承宿主机的环境变量
+	Cwd  string   `json:"cwd"`  // 容器内的工作目录
+	User string   `json:"user"` // 运行用户 user[:group]，支持用户名或id
+	Tty  bool     `json:"tty"`  // 标准输入输出是否为伪终端
+}
+
+// 根据容器配置生成 exec 的启动配置，未指定的用户与工作目录使用容器的配置
+// env 为容器init进程的环境变量，extraEnv 中同名的变量会覆盖它们
+func NewExecSpec(info *Info, args, env, extraEnv []string, user, cwd string, tty bool) *ExecSpec {
+	if user == "" {
+		user = info.User
+	}
+	if cwd == "" {
+		cwd = info.WorkingDir
+	}
+	if cwd == "" {
+		cwd = "/"
+	}
+	if tty {
+		env = append(env, "TERM=xterm")
+	}
+
+	return &ExecSpec{
+		Args: args,
+		Env:  mergeEnv(env, extraEnv),
+		Cwd:  cwd,
+		User: user,
+		Tty:  tty,
+	}
+}
+
+// 合并环境变量，后出现的同名变量覆盖先出现的
+func mergeEnv(envs ...[]string) []string {
+	var merged []string
+	index := make(map[string]int)
+	for _, env := range envs {
+		for _, kv := range env {
+			if kv == "" {
+				continue
+			}
+			key, _, _ := strings.Cut(kv, "=")
+			if i, ok := index[key]; ok {
+				merged[i] = kv
+				continue
+			}
+			index[key] = len(merged)
+			merged = append(merged, kv)
+		}
+	}
+	return merged
+}
+
+// 校验 exec 需要进入的namespace
+func ParseExecNamespaces(namespaces []string) ([]string, error) {
+	valid := make(map[string]bool)
+	for _, ns := range ExecNamespaces {
+		valid[ns] = true
+	}
+	for _, ns := range namespaces {
+		if !valid[ns] {
+			return nil, errors.Errorf("unknown namespace %s, supported: %s", ns, strings.Join(ExecNamespaces, ","))
+		}
+	}
+	return namespaces, nil
+}
+
+// exec 进程的入口，此时 nsenter 已经将进程加入容器的cgroup与namespace
+// 读取启动配置，以指定的用户、工作目录与环境变量执行用户命令，成功时不会返回
+func RunExecProcess() error {
+	pipe := os.NewFile(uintptr(specPipeFd), "spec-pipe")
+	spec := new(ExecSpec)
+	err := json.NewDecoder(pipe).Decode(spec)
+	_ = pipe.Close()
+	if err != nil {
+		return errors.Wrap(err, "decode exec spec failed")
+	}
+	if len(spec.Args) == 0 {
+		return errors.New("missing exec command")
+	}
+
+	// 使用伪终端时创建新的会话，并将伪终端设置为控制终端
+	if spec.Tty {
+		if _, err = unix.Setsid(); err != nil {
+			return errors.Wrap(err, "setsid failed")
+		}
+		if err = unix.IoctlSetInt(0, unix.TIOCSCTTY, 0); err != nil {
+			return errors.Wrap(err, "set controlling terminal failed")
+		}
+	}
+
+	return execUserProcess(spec.Args, spec.Env, spec.Cwd, spec.User)
+}
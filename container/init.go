@@ -3,25 +3,93 @@
 package container
 
 import (
-	"io"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"syscall"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
+// 容器init进程的入口，初始化失败时将错误通过同步Pipe返回给父进程
 func RunContainerInitProcess() error {
-	setUpMount()
+	// exec 成功后同步Pipe自动关闭，父进程由此得知初始化完成
+	syscall.CloseOnExec(syncPipeFd)
+
+	if err := initContainer(); err != nil {
+		log.Errorf("RunContainerInitProcess: %v", err)
+		reportInitError(err)
+		return err
+	}
+	return nil
+}
+
+func initContainer() error {
+	spec, err := readInitSpec()
+	if err != nil {
+		return err
+	}
+
+	// 进程创建后才加入容器cgroup时(cgroup v1 或 systemd 驱动)，父进程在发送配置前已将当前进程加入容器cgroup，
+	// 此时创建的 cgroup namespace 以容器cgroup为根
+	// unshare 只对当前线程生效，锁定线程使之后的挂载与 exec 都在该线程中进行，exec 前不再解锁
+	if spec.UnshareCgroupNs {
+		runtime.LockOSThread()
+		if err = unix.Unshare(unix.CLONE_NEWCGROUP); err != nil {
+			return errors.Wrap(err, "create cgroup namespace failed")
+		}
+	}
+
+	if err = syscall.Sethostname([]byte(spec.Hostname)); err != nil {
+		return errors.Wrap(err, "set hostname failed")
+	}
+
+	if err = setUpMount(spec.Mounts, spec.Symlinks, spec.Console); err != nil {
+		return err
+	}
+
+	if err = setRlimits(spec.Rlimits); err != nil {
+		return err
+	}
+
+	return execUserProcess(spec.Args, spec.Env, spec.Cwd, spec.User)
+}
+
+// 以指定的用户、工作目录与环境变量执行用户命令，init 与 exec 进程共用，成功时不会返回
+// 用户名在容器的rootfs中查找，需在进入容器的 mount namespace 之后调用
+func execUserProcess(args, env []string, cwd, userSpec string) error {
+	execUser, err := LookupUser(userSpec)
+	if err != nil {
+		return errors.WithMessage(err, "lookup user failed")
+	}
+
+	// 使用配置中的环境变量替换从父进程继承的环境变量
+	os.Clearenv()
+	for _, kv := range env {
+		key, value, _ := strings.Cut(kv, "=")
+		_ = os.Setenv(key, value)
+	}
+	if os.Getenv("HOME") == "" {
+		_ = os.Setenv("HOME", execUser.Home)
+	}
+
+	if err = syscall.Chdir(cwd); err != nil {
+		return errors.Wrapf(err, "change to work dir %s failed", cwd)
+	}
+
+	if err = setUser(execUser); err != nil {
+		return err
+	}
 
-	cmdArray := readUserCommand()
 	// 根据命令查找环境变量，找到可执行文件
-	path, err := exec.LookPath(cmdArray[0])
+	path, err := exec.LookPath(args[0])
 	if err != nil {
-		log.Error(err)
+		return errors.Wrapf(err, "look path %s failed", args[0])
 	}
 
 	// 利用syscall.Exec()方法调用execve系统调用，覆盖当前进程，使容器中运行的
@@ -29,53 +97,101 @@ func RunContainerInitProcess() error {
 	// 第一个参数为可执行二进制文件路径， 如 "/bin/ls"
 	// 第二个参数为具体命令 []string, 如 ["ls", "./"]
 	// 第三个参数为环境变量
-	if err := syscall.Exec(path, cmdArray[0:], os.Environ()); err != nil {
-		log.Errorf("RunContainerInitProcess exec: %s", err.Error())
+	if err = syscall.Exec(path, args, os.Environ()); err != nil {
+		return errors.Wrapf(err, "exec %s failed", path)
 	}
 
 	return nil
 }
 
-func readUserCommand() []string {
-	pipe := os.NewFile(uintptr(3), "pipe")
-	// Pipe为空时，子进程阻塞
-	msg, err := io.ReadAll(pipe)
-	if err != nil {
-		log.Errorf("error while reading from pipe %v", err)
+func setRlimits(rlimits []Rlimit) error {
+	for _, rl := range rlimits {
+		typ, ok := rlimitTypes[rl.Type]
+		if !ok {
+			return fmt.Errorf("unknown rlimit type %s", rl.Type)
+		}
+		if err := unix.Setrlimit(typ, &unix.Rlimit{Cur: rl.Soft, Max: rl.Hard}); err != nil {
+			return errors.Wrapf(err, "set rlimit %s failed", rl.Type)
+		}
 	}
+	return nil
+}
 
-	msgStr := string(msg)
-	return strings.Split(msgStr, " ")
+// 切换运行用户，需要先设置组再设置uid，否则会失去修改组的权限
+func setUser(execUser *ExecUser) error {
+	if err := syscall.Setgroups(execUser.Groups); err != nil {
+		return errors.Wrap(err, "set groups failed")
+	}
+	if err := syscall.Setgid(execUser.Gid); err != nil {
+		return errors.Wrapf(err, "set gid %d failed", execUser.Gid)
+	}
+	if err := syscall.Setuid(execUser.Uid); err != nil {
+		return errors.Wrapf(err, "set uid %d failed", execUser.Uid)
+	}
+	return nil
 }
 
-// Mount "/proc", make process information visible.
-func setUpMount() {
+// 切换rootfs并完成容器内的挂载, 如 "/proc"
+func setUpMount(mounts []Mount, symlinks []Symlink, console string) error {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Error(err)
-		return
+		return errors.Wrap(err, "get work directory failed")
 	}
 	log.Infof("Current work directory is %s", wd)
 
 	// systemd 加入linux之后, mount namespace 就变成 shared by default, 所以你必须显示
 	// 声明你要这个新的mount namespace独立。
 	// 如果不先做 private mount，会导致挂载事件外泄，后续执行 pivotRoot 会出现 invalid argument 错误
-	syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, "")
+	if err = syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, ""); err != nil {
+		return errors.Wrap(err, "make / private failed")
+	}
 
-	err = pivotRoot(wd)
-	if err != nil {
-		log.Error(err)
+	if err = pivotRoot(wd); err != nil {
+		return err
+	}
+
+	for _, m := range mounts {
+		if err = os.MkdirAll(m.Target, 0755); err != nil {
+			return errors.Wrapf(err, "mkdir %s failed", m.Target)
+		}
+		if err = syscall.Mount(m.Source, m.Target, m.Type, uintptr(m.Flags), m.Data); err != nil {
+			return errors.Wrapf(err, "mount %s to %s failed", m.Source, m.Target)
+		}
+	}
+	for _, l := range symlinks {
+		if err = os.Symlink(l.Source, l.Target); err != nil && !os.IsExist(err) {
+			return errors.Wrapf(err, "create symlink %s failed", l.Target)
+		}
 	}
 
-	// mount时禁止以下行为
-	// 重新挂载 procfs
-	defaltMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	_ = syscall.Mount("proc", "/proc", "proc", uintptr(defaltMountFlags), "")
+	// 伪终端 slave 端位于宿主机的 devpts 中，需要在卸载旧rootfs之前通过旧rootfs中的路径完成绑定
+	if err = setUpConsole(console); err != nil {
+		return err
+	}
+	return unmountOldRoot()
+}
 
-	// 由于前面 pivotRoot 切换了 rootfs，因此这里重新 mount 一下 /dev 目录
-	// tmpfs 是基于 件系 使用 RAM、swap 分区来存储。
-	// 不挂载 /dev，会导致容器内部无法访问和使用许多设备，这可能导致系统无法正常工作
-	syscall.Mount("tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755")
+// /dev/ptmx 指向容器自己的 devpts 实例
+// 使用伪终端时将宿主机分配的伪终端 slave 端绑定到 /dev/console
+// 不能通过 /proc/self/fd/0 绑定，它指向宿主机 mount namespace 中的挂载，会返回 EINVAL
+func setUpConsole(console string) error {
+	if err := os.Symlink("pts/ptmx", "/dev/ptmx"); err != nil && !os.IsExist(err) {
+		return errors.Wrap(err, "create /dev/ptmx failed")
+	}
+	if console == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile("/dev/console", os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "create /dev/console failed")
+	}
+	f.Close()
+	source := filepath.Join("/.pivot_root", console)
+	if err = syscall.Mount(source, "/dev/console", "", syscall.MS_BIND, ""); err != nil {
+		return errors.Wrap(err, "mount console failed")
+	}
+	return nil
 }
 
 // 为当前容器挂载新的rootfs
@@ -99,34 +215,15 @@ func pivotRoot(root string) error {
 	if err := syscall.Chdir("/"); err != nil {
 		return errors.WithMessage(err, "change to / fail")
 	}
+	return nil
+}
 
-	// 将旧rootfs umount以便删除
-	pivotDir = filepath.Join("/", ".pivot_root")
+// 将旧rootfs umount以便删除
+func unmountOldRoot() error {
+	pivotDir := filepath.Join("/", ".pivot_root")
 	if err := syscall.Unmount(pivotDir, syscall.MNT_DETACH); err != nil {
 		return errors.WithMessage(err, "umount pivot dir fail")
 	}
 
 	return os.Remove(pivotDir)
 }
-
-func StartContainerInitProcess() error {
-	setUpMount()
-
-	startCmd := "top"
-	// 根据命令查找环境变量，找到可执行文件
-	path, err := exec.LookPath(startCmd)
-	if err != nil {
-		log.Error(err)
-	}
-
-	// 利用syscall.Exec()方法调用execve系统调用，覆盖当前进程，使容器中运行的
-	// command 成为PID 1 (实际上运行的第一个command是 mydocker init ...)
-	// 第一个参数为可执行二进制文件路径， 如 "/bin/ls"
-	// 第二个参数为具体命令 []string, 如 ["ls", "./"]
-	// 第三个参数为环境变量
-	if err := syscall.Exec(path, []string{startCmd}, os.Environ()); err != nil {
-		log.Errorf("RunContainerInitProcess exec: %s", err.Error())
-	}
-
-	return nil
-}
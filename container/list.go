@@ -3,55 +3,242 @@ package container
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
-// 遍历读取InfoLoc下的文件并格式化输出
-func ListContainers() {
-	files, err := os.ReadDir(InfoLoc)
+// ps 命令的参数
+type ListOptions struct {
+	All     bool     // 列出所有容器，默认只列出运行中与暂停的容器
+	Quiet   bool     // 只输出容器ID
+	Last    int      // 只列出最近创建的N个容器，隐含 All
+	Filters []string // 过滤条件，e.g., status=exited, label=env=prod
+	Format  string   // 输出格式: table, json 或 Go template
+}
+
+// 遍历读取InfoLoc下的文件，过滤后按照创建时间从新到旧格式化输出
+func ListContainers(opts ListOptions) error {
+	filters, err := parseListFilters(opts.Filters)
 	if err != nil {
-		logrus.Errorf("read file %s failed, err: %v", files, err)
+		return err
 	}
 
-	infoList := make([]*Info, 0, len(files))
-	for _, f := range files {
-		containerInfo, err := getContainerInfo(f)
-		if err != nil {
-			logrus.Errorf("read container info err: %v", err)
+	infoList, err := GetAllContainerInfos()
+	if err != nil {
+		return errors.WithMessage(err, "read container infos failed")
+	}
+
+	sort.Slice(infoList, func(i, j int) bool {
+		if infoList[i].CreatedTime != infoList[j].CreatedTime {
+			return infoList[i].CreatedTime > infoList[j].CreatedTime
+		}
+		return infoList[i].Id > infoList[j].Id
+	})
+
+	// 指定状态或退出码过滤时，与 docker 一致不再只列出运行中的容器
+	all := opts.All || opts.Last > 0 || len(filters["status"]) > 0 || len(filters["exited"]) > 0
+	var matched []*Info
+	for _, info := range infoList {
+		if !all && info.Status != RUNNING && info.Status != PAUSED {
 			continue
 		}
-		infoList = append(infoList, containerInfo)
+		if !filters.match(info) {
+			continue
+		}
+		matched = append(matched, info)
+		if opts.Last > 0 && len(matched) == opts.Last {
+			break
+		}
 	}
 
+	if opts.Quiet {
+		for _, info := range matched {
+			fmt.Println(info.Id)
+		}
+		return nil
+	}
+	return writeContainerList(os.Stdout, matched, opts.Format)
+}
+
+// 按照 format 输出容器列表，json 格式每行输出一个容器，便于其他工具逐行解析
+// Go template 以 table 开头时按列对齐输出, e.g., --format 'table {{.Id}}\t{{.Status}}'
+func writeContainerList(out io.Writer, infoList []*Info, format string) error {
+	switch format {
+	case "", "table":
+		return writeContainerTable(out, infoList)
+	case "json":
+		encoder := json.NewEncoder(out)
+		for _, info := range infoList {
+			if err := encoder.Encode(info); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := out
+	var tw *tabwriter.Writer
+	if strings.HasPrefix(format, "table ") {
+		// 命令行中难以输入制表符，允许使用 \t 分隔各列
+		format = strings.ReplaceAll(strings.TrimPrefix(format, "table "), `\t`, "\t")
+		tw = tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+		w = tw
+	}
+	for _, info := range infoList {
+		if err := utils.ExecuteTemplate(w, format, info); err != nil {
+			return err
+		}
+	}
+	if tw != nil {
+		return tw.Flush()
+	}
+	return nil
+}
+
+func writeContainerTable(out io.Writer, infoList []*Info) error {
 	// 使用tabwriter进行格式化输出
-	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	_, err = fmt.Fprint(w, "ID\tNAME\tIMAGE\tPID\tIP\tSTATUS\tCOMMAND\tCREATED\n")
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	_, err := fmt.Fprint(w, "ID\tNAME\tIMAGE\tPID\tIP\tSTATUS\tRESTARTS\tCOMMAND\tCREATED\n")
 	if err != nil {
-		logrus.Errorf("Fprint err: %v", err)
+		return err
 	}
 
 	for _, info := range infoList {
-		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
 			info.Id,
 			info.Name,
 			info.Image,
 			info.Pid,
 			info.IP,
-			info.Status,
+			displayStatus(info),
+			info.RestartCount,
 			info.Command,
 			info.CreatedTime)
 		if err != nil {
-			logrus.Errorf("Fprint err: %v", err)
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// 过滤条件，同一个key的多个值之间为或，不同key之间为与
+type listFilters map[string][]string
+
+func parseListFilters(args []string) (listFilters, error) {
+	filters := make(listFilters)
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid filter %s, should be key=value", arg)
+		}
+		switch key {
+		case "id", "name", "image", "network", "label":
+		case "status":
+			if !isValidStatus(value) {
+				return nil, fmt.Errorf("invalid filter status=%s", value)
+			}
+		case "exited":
+			if _, err := strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid filter exited=%s, should be an exit code", value)
+			}
+		default:
+			return nil, fmt.Errorf("invalid filter key %s", key)
+		}
+		filters[key] = append(filters[key], value)
+	}
+	return filters, nil
+}
+
+func isValidStatus(status string) bool {
+	switch status {
+	case CREATED, RUNNING, RESTARTING, PAUSED, STOP, EXITED:
+		return true
+	}
+	return false
+}
+
+func (filters listFilters) match(info *Info) bool {
+	for key, values := range filters {
+		matched := false
+		for _, value := range values {
+			if matchFilter(info, key, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
 		}
 	}
+	return true
+}
 
-	if err = w.Flush(); err != nil {
-		logrus.Errorf("flush err: %v", err)
+func matchFilter(info *Info, key, value string) bool {
+	switch key {
+	case "id":
+		return strings.HasPrefix(info.Id, value)
+	case "name":
+		return strings.Contains(info.Name, value)
+	case "image":
+		return info.Image == value
+	case "network":
+		return info.NetworkName == value
+	case "status":
+		return info.Status == value
+	case "exited":
+		// 只有已退出的容器才有意义的退出码
+		return info.Status == EXITED && strconv.Itoa(info.ExitCode) == value
+	case "label":
+		// label=key 只要求存在该标签，label=key=value 还要求值相同
+		k, v, hasValue := strings.Cut(value, "=")
+		labelValue, ok := info.Labels[k]
+		return ok && (!hasValue || labelValue == v)
+	}
+	return false
+}
+
+// 已退出及等待重启的容器同时展示最近一次的退出码与是否因OOM退出, e.g., exited (137, OOMKilled)
+func displayStatus(info *Info) string {
+	if info.Status == EXITED || info.Status == RESTARTING {
+		if info.OOMKilled {
+			return fmt.Sprintf("%s (%d, OOMKilled)", info.Status, info.ExitCode)
+		}
+		return fmt.Sprintf("%s (%d)", info.Status, info.ExitCode)
+	}
+	return info.Status
+}
+
+// 读取 InfoLoc 下所有容器的信息，跳过无法读取的记录
+func GetAllContainerInfos() ([]*Info, error) {
+	files, err := os.ReadDir(InfoLoc)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	infoList := make([]*Info, 0, len(files))
+	for _, f := range files {
+		containerInfo, err := getContainerInfo(f)
+		if err != nil {
+			logrus.Errorf("read container info err: %v", err)
+			continue
+		}
+		infoList = append(infoList, containerInfo)
 	}
+	return infoList, nil
 }
 
 func getContainerInfo(f os.DirEntry) (*Info, error) {
@@ -4,6 +4,7 @@ import (
 	"mydocker/utils"
 	"os"
 	"os/exec"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -35,6 +36,38 @@ func NewWorkSpace(containerID, imageName, volume string) error {
 	return nil
 }
 
+// 重新挂载已存在容器的 OverlayFS 与 volume，用于 start 已停止的容器
+// 宿主机重启等情况下挂载点会丢失，已挂载时则跳过
+func MountWorkSpace(containerID, volume string) error {
+	mntPath := utils.GetMerged(containerID)
+	if exist, err := utils.PathExist(mntPath); !exist {
+		return errors.Wrapf(err, "work space of container %s does not exist", containerID)
+	}
+
+	mounted, err := utils.IsMountPoint(mntPath)
+	if err != nil {
+		return errors.Wrap(err, "check overlayfs mount failed")
+	}
+	if !mounted {
+		mountOverlayFS(containerID)
+	}
+
+	if volume != "" {
+		hostPath, containerPath, err := volumeParse(volume)
+		if err != nil {
+			return errors.Wrap(err, "parse volume path failed")
+		}
+		mounted, err = utils.IsMountPoint(filepath.Join(mntPath, containerPath))
+		if err != nil {
+			return errors.Wrap(err, "check volume mount failed")
+		}
+		if !mounted {
+			mountVolume(mntPath, hostPath, containerPath)
+		}
+	}
+	return nil
+}
+
 // 将指定镜像挂载为 overlayfs 的 lower filesystem
 func createLower(containerID, imageName string) error {
 	lowerPath := utils.GetLower(containerID)
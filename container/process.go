@@ -1,32 +1,42 @@
 // 容器进程创建前的准备工作，包括
 // 1. 初始化命令cmd
 // 2. 创建Namespace进行视图隔离
-// 3. 准备Overlayfs相关文件挂载
+// 3. 指定容器的工作目录与输出
 
 package container
 
 import (
-	"os"
 	"os/exec"
-	"path/filepath"
 	"syscall"
 
+	"mydocker/cgroups"
+	"mydocker/cgroups/resource"
 	"mydocker/utils"
 
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 const (
+	CREATED    = "created"
 	RUNNING    = "running"
+	RESTARTING = "restarting"
+	PAUSED     = "paused"
 	STOP       = "stopped"
-	EXIST      = "existed"
+	EXITED     = "exited"
 	InfoLoc    = "/var/lib/mydocker/containers/"
 	ConfigName = "config.json"
 	IDLength   = 10
 	LogFile    = "%s-json.log"
 )
 
+// 容器的 cgroup namespace 模式
+const (
+	// 容器使用独立的 cgroup namespace，以自身cgroup作为根
+	CgroupNsPrivate = "private"
+	// 容器与宿主机共享 cgroup namespace
+	CgroupNsHost = "host"
+)
+
 type Info struct {
 	Pid         string   `json:"pid"`         // 容器的init进程在宿主机上的PID
 	Id          string   `json:"id"`          // 容器的ID
@@ -39,6 +49,49 @@ type Info struct {
 	NetworkName string   `json:"network"`     // 容器所在网络名
 	IP          string   `json:"ip"`          // 容器IP
 	PortMapping []string `json:"portmapping"` // 容器端口映射
+	CgroupPath  string   `json:"cgrouppath"`  // 容器cgroup的相对路径
+	CmdArray    []string `json:"cmdarray"`    // 容器启动命令的参数数组
+	Env         []string `json:"env"`         // 用户指定的环境变量
+	Hostname    string   `json:"hostname"`    // 容器主机名，默认为容器ID
+	User        string   `json:"user"`        // 容器内的运行用户
+	WorkingDir  string   `json:"workingdir"`  // 容器内的工作目录
+	Rlimits     []Rlimit `json:"rlimits"`     // 容器进程的资源限制
+	StopSignal  string   `json:"stopsignal"`  // stop 时发送给容器的信号，默认为 SIGTERM
+	Tty         bool     `json:"tty"`         // 是否为容器分配伪终端
+	OpenStdin   bool     `json:"openstdin"`   // 是否保持容器的标准输入打开，供 attach 写入
+
+	Labels map[string]string `json:"labels"` // 用户为容器设置的标签
+
+	MonitorPid   string `json:"monitorpid"`   // 后台容器监控进程的PID
+	StartedTime  string `json:"startedtime"`  // 容器最近一次的启动时间
+	FinishedTime string `json:"finishedtime"` // 容器最近一次的退出时间
+	ExitCode     int    `json:"exitcode"`     // 容器最近一次退出的退出码
+	ExitSeq      uint64 `json:"exitseq"`      // 容器的退出次数，每次退出时递增，用于等待下一次退出
+	OOMKilled    bool   `json:"oomkilled"`    // 容器最近一次退出是否由于OOM
+	OOMKillCount uint64 `json:"oomkillcount"` // 容器最近一次运行期间因OOM被杀死的进程数
+
+	RestartPolicy   RestartPolicy `json:"restartpolicy"`   // 容器退出后的重启策略
+	RestartCount    int           `json:"restartcount"`    // 由重启策略触发的重启次数
+	ManuallyStopped bool          `json:"manuallystopped"` // 是否被手动stop，手动stop的容器不会被重启
+
+	Resource     *resource.ResourceConfig `json:"resource"`     // 容器的资源限制
+	CgroupDriver string                   `json:"cgroupdriver"` // 管理容器cgroup的驱动，为空时使用 cgroupfs
+	CgroupParent string                   `json:"cgroupparent"` // 容器cgroup的父cgroup，systemd 驱动下为 slice 名
+	CgroupNs     string                   `json:"cgroupns"`     // 容器的 cgroup namespace 模式, private 或 host
+}
+
+// 解析 --cgroupns 参数，未指定时 cgroup v2 下默认使用独立的 cgroup namespace，v1 下与宿主机共享
+func ParseCgroupNs(mode string) (string, error) {
+	switch mode {
+	case "":
+		if cgroups.IsUnifiedCgroup() {
+			return CgroupNsPrivate, nil
+		}
+		return CgroupNsHost, nil
+	case CgroupNsPrivate, CgroupNsHost:
+		return mode, nil
+	}
+	return "", errors.Errorf("invalid cgroupns mode %s, only %s and %s are supported", mode, CgroupNsPrivate, CgroupNsHost)
 }
 
 // Instantiate a child process initialization command
@@ -64,11 +117,13 @@ type Info struct {
 // }
 
 // 创建子进程启动命令，通过Pipe，父进程向子进程传递参数
-func NewParentProcessPipe(tty bool, volume, containerID, imageName string, envSlice []string) (*exec.Cmd, *os.File, error) {
-	rPipe, wPipe, err := os.Pipe()
-
+// 容器的文件系统需要提前通过 NewWorkSpace 或 MountWorkSpace 准备好
+// 容器的启动配置在进程启动后通过 InitPipe.Send 发送
+// stdio 由监控进程创建，使用伪终端时 slave 端同时作为容器的控制终端
+func NewParentProcessPipe(stdio *Stdio, containerID string) (*exec.Cmd, *InitPipe, error) {
+	initPipe, err := newInitPipe()
 	if err != nil {
-		logrus.Error(err)
+		return nil, nil, err
 	}
 
 	// /proc/self/exe 表示当前正在运行的可执行文件的路径（符号链接到当前进程的可执行文件)
@@ -80,42 +135,24 @@ func NewParentProcessPipe(tty bool, volume, containerID, imageName string, envSl
 			syscall.CLONE_NEWIPC,
 	}
 
-	if tty {
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-	} else {
-		// 将执行输出记录到指定的日志文件中
-		dirPath := filepath.Join(InfoLoc, containerID)
-		exists, _ := utils.PathExist(dirPath)
-		if !exists {
-			if err := os.MkdirAll(dirPath, 0622); err != nil {
-				return nil, nil, errors.Wrapf(err, "mkdir %s failed", dirPath)
-			}
-		}
-
-		stdLogFilePath := filepath.Join(dirPath, GetLogFile(containerID))
-		stdLogFile, err := os.Create(stdLogFilePath)
-		if err != nil {
-			return nil, nil, errors.Wrapf(err, "create log file %s failed", stdLogFilePath)
-		}
-
-		cmd.Stdout = stdLogFile
-		cmd.Stderr = stdLogFile
+	if stdio.Stdin != nil {
+		cmd.Stdin = stdio.Stdin
+	}
+	cmd.Stdout = stdio.Stdout
+	cmd.Stderr = stdio.Stderr
+	if stdio.Console != "" {
+		// 容器进程成为新会话的首进程，并将伪终端设置为控制终端，Ctty 为子进程中的 fd 0
+		cmd.SysProcAttr.Setsid = true
+		cmd.SysProcAttr.Setctty = true
+		cmd.SysProcAttr.Ctty = 0
 	}
 
-	// 通过ExtraFile将rPipe传递给子进程
-	cmd.ExtraFiles = []*os.File{rPipe}
+	// 通过ExtraFile将 spec pipe 的读端与 sync pipe 的写端传递给子进程
+	// 在子进程中分别对应 fd 3 和 fd 4
+	cmd.ExtraFiles = initPipe.childFiles
 
-	// File Systems
-	err = NewWorkSpace(containerID, imageName, volume)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "create work space failed")
-	}
 	// Specify work dir
 	cmd.Dir = utils.GetMerged(containerID)
 
-	cmd.Env = append(os.Environ(), envSlice...)
-
-	return cmd, wPipe, nil
+	return cmd, initPipe, nil
 }
@@ -8,8 +8,7 @@ import (
 	"mydocker/utils"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -26,54 +25,93 @@ func randStringBytes(n int) string {
 	return string(b)
 }
 
-func RecordContainerInfo(containerPID int, commandArray []string, containerName, containerID, volume, net, ip, image string,
-	portMapping []string) (*Info, error) {
-	if containerName == "" {
-		containerName = containerID
+// 将容器信息写入 InfoLoc/{containerID}/config.json，首次记录时补全容器名与创建时间
+func RecordContainerInfo(containerInfo *Info) error {
+	if containerInfo.Name == "" {
+		containerInfo.Name = containerInfo.Id
 	}
-	command := strings.Join(commandArray, " ")
-
-	containerInfo := &Info{
-		Pid:         strconv.Itoa(containerPID),
-		Id:          containerID,
-		Name:        containerName,
-		Command:     command,
-		CreatedTime: time.Now().Format("2006-01-02 15:04:05"),
-		Status:      RUNNING,
-		Volume:      volume,
-		NetworkName: net,
-		IP:          ip,
-		PortMapping: portMapping,
-		Image:       image,
+	if containerInfo.CreatedTime == "" {
+		containerInfo.CreatedTime = time.Now().Format("2006-01-02 15:04:05")
 	}
 
 	jsonBytes, err := json.Marshal(containerInfo)
 	if err != nil {
-		return containerInfo, errors.WithMessage(err, "container info marshal failed")
+		return errors.WithMessage(err, "container info marshal failed")
 	}
 	jsonStr := string(jsonBytes)
 
 	// 容器信息路径: InfoLoc/{containerID}/
-	dirPath := filepath.Join(InfoLoc, containerID)
+	dirPath := filepath.Join(InfoLoc, containerInfo.Id)
 	exists, _ := utils.PathExist(dirPath)
 	if !exists {
 		if err = os.MkdirAll(dirPath, 0622); err != nil {
-			return containerInfo, errors.WithMessagef(err, "mkdir %s failed", dirPath)
+			return errors.WithMessagef(err, "mkdir %s failed", dirPath)
 		}
 	}
 
+	// 先写入同目录下的临时文件再重命名，不加锁读取的 ps、wait 等命令不会读到写了一半的文件
 	fileName := filepath.Join(dirPath, ConfigName)
-	file, err := os.Create(fileName)
+	file, err := os.CreateTemp(dirPath, ConfigName+".tmp-*")
 	if err != nil {
-		return containerInfo, errors.WithMessagef(err, "create file %s failed", fileName)
+		return errors.WithMessagef(err, "create temp file in %s failed", dirPath)
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
 	if _, err = file.WriteString(jsonStr); err != nil {
-		return containerInfo, errors.WithMessagef(err, "write container info to file %s failed", fileName)
+		file.Close()
+		return errors.WithMessagef(err, "write container info to file %s failed", file.Name())
+	}
+	if err = file.Chmod(0644); err != nil {
+		file.Close()
+		return errors.WithMessagef(err, "chmod file %s failed", file.Name())
+	}
+	if err = file.Close(); err != nil {
+		return errors.WithMessagef(err, "close file %s failed", file.Name())
+	}
+	if err = os.Rename(file.Name(), fileName); err != nil {
+		return errors.WithMessagef(err, "rename %s to %s failed", file.Name(), fileName)
+	}
+
+	return nil
+}
+
+// 读取 InfoLoc/{containerID}/config.json 中的容器信息
+func GetContainerInfo(containerID string) (*Info, error) {
+	infoFilePath := filepath.Join(InfoLoc, containerID, ConfigName)
+	content, err := os.ReadFile(infoFilePath)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "read file %s failed", infoFilePath)
 	}
+	info := new(Info)
+	if err = json.Unmarshal(content, info); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal json failed")
+	}
+	return info, nil
+}
+
+// 在文件锁的保护下读取、修改并写回容器信息
+// 避免 monitor 与 stop 等进程同时修改容器状态时相互覆盖
+func UpdateContainerInfo(containerID string, update func(info *Info) error) error {
+	dirPath := filepath.Join(InfoLoc, containerID)
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return errors.WithMessagef(err, "open %s failed", dirPath)
+	}
+	defer dir.Close()
 
-	return containerInfo, nil
+	if err = syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		return errors.WithMessagef(err, "lock %s failed", dirPath)
+	}
+	defer syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+
+	info, err := GetContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+	if err = update(info); err != nil {
+		return err
+	}
+	return RecordContainerInfo(info)
 }
 
 func GenerateContainerID() string {
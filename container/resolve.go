@@ -0,0 +1,88 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// 根据完整ID、容器名或唯一的ID前缀查找容器，优先级依次降低
+func ResolveContainer(ref string) (*Info, error) {
+	if ref == "" {
+		return nil, errors.New("empty container id or name")
+	}
+
+	// 完整ID直接对应 InfoLoc 下的目录，只有合法的ID才能拼接到路径中，避免读取 InfoLoc 之外的文件
+	if len(ref) == IDLength && isValidID(ref) {
+		if info, err := GetContainerInfo(ref); err == nil {
+			return info, nil
+		}
+	}
+
+	infos, err := GetAllContainerInfos()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load containers failed")
+	}
+
+	for _, info := range infos {
+		if info.Name == ref {
+			return info, nil
+		}
+	}
+
+	var matched []*Info
+	for _, info := range infos {
+		if strings.HasPrefix(info.Id, ref) {
+			matched = append(matched, info)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("no such container: %s", ref)
+	case 1:
+		return matched[0], nil
+	default:
+		ids := make([]string, 0, len(matched))
+		for _, info := range matched {
+			ids = append(ids, info.Id)
+		}
+		return nil, fmt.Errorf("container id prefix %s is ambiguous, matches: %s", ref, strings.Join(ids, ", "))
+	}
+}
+
+// 容器ID只由字母与数字组成
+func isValidID(id string) bool {
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// 同 ResolveContainer，只返回容器ID
+func ResolveContainerID(ref string) (string, error) {
+	info, err := ResolveContainer(ref)
+	if err != nil {
+		return "", err
+	}
+	return info.Id, nil
+}
+
+// 检查容器名是否已被其他容器使用
+func CheckNameAvailable(name string) error {
+	if name == "" {
+		return nil
+	}
+	infos, err := GetAllContainerInfos()
+	if err != nil {
+		return errors.WithMessage(err, "load containers failed")
+	}
+	for _, info := range infos {
+		if info.Name == name {
+			return fmt.Errorf("container name %s is already in use by container %s", name, info.Id)
+		}
+	}
+	return nil
+}
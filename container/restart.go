@@ -0,0 +1,74 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	RestartNo            = "no"             // 不自动重启
+	RestartOnFailure     = "on-failure"     // 退出码非0时重启，可限制最大重启次数
+	RestartAlways        = "always"         // 总是重启
+	RestartUnlessStopped = "unless-stopped" // 除非被手动stop，否则总是重启
+)
+
+type RestartPolicy struct {
+	Name              string `json:"name"`
+	MaximumRetryCount int    `json:"maximumretrycount"` // 仅对 on-failure 生效，0 表示不限制
+}
+
+// 解析 --restart 参数, e.g., no, always, unless-stopped, on-failure:3
+func ParseRestartPolicy(policy string) (RestartPolicy, error) {
+	if policy == "" {
+		return RestartPolicy{Name: RestartNo}, nil
+	}
+
+	name, retry, hasRetry := strings.Cut(policy, ":")
+	p := RestartPolicy{Name: name}
+	switch name {
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+		if hasRetry {
+			return p, fmt.Errorf("maximum retry count cannot be used with restart policy %s", name)
+		}
+	case RestartOnFailure:
+		if hasRetry {
+			count, err := strconv.Atoi(retry)
+			if err != nil || count < 0 {
+				return p, fmt.Errorf("invalid maximum retry count %s", retry)
+			}
+			p.MaximumRetryCount = count
+		}
+	default:
+		return p, fmt.Errorf("invalid restart policy %s", policy)
+	}
+	return p, nil
+}
+
+func (p RestartPolicy) String() string {
+	if p.Name == RestartOnFailure && p.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", p.Name, p.MaximumRetryCount)
+	}
+	return p.Name
+}
+
+// 容器退出后根据重启策略判断是否需要重启，手动stop的容器不会重启
+// 没有常驻的 daemon，因此 always 与 unless-stopped 的行为一致
+func (info *Info) ShouldRestart() bool {
+	if info.ManuallyStopped {
+		return false
+	}
+
+	switch info.RestartPolicy.Name {
+	case RestartAlways, RestartUnlessStopped:
+		return true
+	case RestartOnFailure:
+		if info.ExitCode == 0 {
+			return false
+		}
+		max := info.RestartPolicy.MaximumRetryCount
+		return max == 0 || info.RestartCount < max
+	default:
+		return false
+	}
+}
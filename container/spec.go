@@ -0,0 +1,344 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"mydocker/cgroups"
+	"mydocker/cgroups/subsystemsv1"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	InitSpecVersion = 1
+	defaultPath     = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+	// 子进程中 ExtraFiles 对应的文件描述符
+	specPipeFd = 3
+	syncPipeFd = 4
+)
+
+// 容器init进程的完整启动配置，以JSON的格式通过Pipe传递
+type InitSpec struct {
+	Version  int       `json:"version"`  // 配置格式版本
+	Args     []string  `json:"args"`     // 用户命令及参数
+	Env      []string  `json:"env"`      // 容器内的环境变量
+	Cwd      string    `json:"cwd"`      // 容器内的工作目录
+	Hostname string    `json:"hostname"` // 容器主机名
+	User     string    `json:"user"`     // 运行用户 user[:group]，支持用户名或id
+	Mounts   []Mount   `json:"mounts"`   // pivot_root 后在容器内进行的挂载
+	Symlinks []Symlink `json:"symlinks"` // 挂载完成后在容器内创建的软链接
+	Rlimits  []Rlimit  `json:"rlimits"`  // 进程资源限制
+	CgroupNs bool      `json:"cgroupns"` // 是否使用独立的 cgroup namespace
+	Console  string    `json:"console"`  // 宿主机上伪终端 slave 端的路径，不为空时将其绑定到 /dev/console
+
+	// 是否由init进程创建 cgroup namespace，为 false 时 namespace 已在 clone 时创建
+	UnshareCgroupNs bool `json:"unsharecgroupns"`
+}
+
+type Mount struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+	Flags  int    `json:"flags"`
+	Data   string `json:"data"`
+}
+
+type Symlink struct {
+	Source string `json:"source"` // 链接指向的路径
+	Target string `json:"target"` // 软链接自身的路径
+}
+
+type Rlimit struct {
+	Type string `json:"type"` // e.g., RLIMIT_NOFILE
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+// init进程初始化失败时通过同步Pipe返回给父进程的信息
+type syncMessage struct {
+	Error string `json:"error"`
+}
+
+var rlimitTypes = map[string]int{
+	"RLIMIT_AS":         unix.RLIMIT_AS,
+	"RLIMIT_CORE":       unix.RLIMIT_CORE,
+	"RLIMIT_CPU":        unix.RLIMIT_CPU,
+	"RLIMIT_DATA":       unix.RLIMIT_DATA,
+	"RLIMIT_FSIZE":      unix.RLIMIT_FSIZE,
+	"RLIMIT_LOCKS":      unix.RLIMIT_LOCKS,
+	"RLIMIT_MEMLOCK":    unix.RLIMIT_MEMLOCK,
+	"RLIMIT_MSGQUEUE":   unix.RLIMIT_MSGQUEUE,
+	"RLIMIT_NICE":       unix.RLIMIT_NICE,
+	"RLIMIT_NOFILE":     unix.RLIMIT_NOFILE,
+	"RLIMIT_NPROC":      unix.RLIMIT_NPROC,
+	"RLIMIT_RSS":        unix.RLIMIT_RSS,
+	"RLIMIT_RTPRIO":     unix.RLIMIT_RTPRIO,
+	"RLIMIT_RTTIME":     unix.RLIMIT_RTTIME,
+	"RLIMIT_SIGPENDING": unix.RLIMIT_SIGPENDING,
+	"RLIMIT_STACK":      unix.RLIMIT_STACK,
+}
+
+// 根据容器信息生成init进程的启动配置，console 为前台容器伪终端 slave 端在宿主机上的路径
+func NewInitSpec(info *Info, console string) *InitSpec {
+	env := []string{defaultPath, "HOSTNAME=" + info.hostname()}
+	if console != "" {
+		env = append(env, "TERM=xterm")
+	}
+	env = append(env, info.Env...)
+
+	cwd := info.WorkingDir
+	if cwd == "" {
+		cwd = "/"
+	}
+
+	mounts := defaultMounts()
+	var symlinks []Symlink
+	cgroupNs := info.CgroupNs == CgroupNsPrivate
+	if cgroupNs {
+		cgroupMounts, cgroupSymlinks, err := cgroupMounts()
+		if err != nil {
+			log.Warnf("find cgroup hierarchies failed, /sys/fs/cgroup will not be mounted, %v", err)
+		}
+		mounts = append(mounts, cgroupMounts...)
+		symlinks = append(symlinks, cgroupSymlinks...)
+	}
+
+	return &InitSpec{
+		Version:  InitSpecVersion,
+		Args:     info.CmdArray,
+		Env:      env,
+		Cwd:      cwd,
+		Hostname: info.hostname(),
+		User:     info.User,
+		Mounts:   mounts,
+		Symlinks: symlinks,
+		Rlimits:  info.Rlimits,
+		CgroupNs: cgroupNs,
+		Console:  console,
+	}
+}
+
+func (info *Info) hostname() string {
+	if info.Hostname != "" {
+		return info.Hostname
+	}
+	return info.Id
+}
+
+func defaultMounts() []Mount {
+	return []Mount{
+		// mount时禁止以下行为
+		// 重新挂载 procfs
+		{
+			Source: "proc",
+			Target: "/proc",
+			Type:   "proc",
+			Flags:  syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV,
+		},
+		// 由于前面 pivotRoot 切换了 rootfs，因此这里重新 mount 一下 /dev 目录
+		// tmpfs 是基于 件系 使用 RAM、swap 分区来存储。
+		// 不挂载 /dev，会导致容器内部无法访问和使用许多设备，这可能导致系统无法正常工作
+		{
+			Source: "tmpfs",
+			Target: "/dev",
+			Type:   "tmpfs",
+			Flags:  syscall.MS_NOSUID | syscall.MS_STRICTATIME,
+			Data:   "mode=755",
+		},
+		// 容器使用独立的 devpts 实例，容器内创建的伪终端与宿主机互不可见
+		{
+			Source: "devpts",
+			Target: "/dev/pts",
+			Type:   "devpts",
+			Flags:  syscall.MS_NOSUID | syscall.MS_NOEXEC,
+			Data:   "newinstance,ptmxmode=0666,mode=0620",
+		},
+	}
+}
+
+// 在容器内挂载只读的cgroup文件系统，处于独立 cgroup namespace 中时只能看到容器自身的cgroup
+// cgroup v1 中多个 subsystem 挂载在同一个 hierarchy 时，为每个 subsystem 创建指向该 hierarchy 的软链接,
+// e.g., cpu -> cpu,cpuacct 与 cpuacct -> cpu,cpuacct
+func cgroupMounts() ([]Mount, []Symlink, error) {
+	const cgroupRoot = "/sys/fs/cgroup"
+	flags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_RDONLY
+	if cgroups.IsUnifiedCgroup() {
+		return []Mount{{Source: "cgroup", Target: cgroupRoot, Type: "cgroup2", Flags: flags}}, nil, nil
+	}
+
+	// cgroup v1 中每个 hierarchy 需要单独挂载
+	hierarchies, err := subsystemsv1.Hierarchies()
+	if err != nil {
+		return nil, nil, err
+	}
+	mounts := []Mount{{
+		Source: "tmpfs",
+		Target: cgroupRoot,
+		Type:   "tmpfs",
+		Flags:  syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV,
+		Data:   "mode=755",
+	}}
+	var symlinks []Symlink
+	for _, h := range hierarchies {
+		// 宿主机上的挂载点可能就是某个 subsystem 的软链接, e.g., /sys/fs/cgroup/cpu -> cpu,cpuacct，
+		// 此时按 subsystem 组合命名，以便为各个 subsystem 创建软链接
+		name := path.Base(h.MountPoint)
+		subsystems := h.Subsystems()
+		if h.Type == "cgroup" && len(subsystems) > 1 {
+			name = strings.Join(subsystems, ",")
+		}
+		mounts = append(mounts, Mount{
+			Source: "cgroup",
+			Target: path.Join(cgroupRoot, name),
+			Type:   h.Type,
+			Flags:  flags,
+			Data:   h.Options,
+		})
+		for _, subsystem := range subsystems {
+			if subsystem == name {
+				continue
+			}
+			symlinks = append(symlinks, Symlink{
+				Source: name,
+				Target: path.Join(cgroupRoot, subsystem),
+			})
+		}
+	}
+	return mounts, symlinks, nil
+}
+
+// 解析 --ulimit 参数, e.g., nofile=1024:2048 或 nproc=512
+func ParseRlimit(ulimit string) (Rlimit, error) {
+	name, value, ok := strings.Cut(ulimit, "=")
+	if !ok {
+		return Rlimit{}, fmt.Errorf("invalid ulimit %s", ulimit)
+	}
+
+	typ := "RLIMIT_" + strings.ToUpper(name)
+	if _, ok = rlimitTypes[typ]; !ok {
+		return Rlimit{}, fmt.Errorf("unknown ulimit type %s", name)
+	}
+
+	softStr, hardStr, hasHard := strings.Cut(value, ":")
+	if !hasHard {
+		hardStr = softStr
+	}
+	soft, err := strconv.ParseUint(softStr, 10, 64)
+	if err != nil {
+		return Rlimit{}, errors.Wrapf(err, "invalid ulimit soft value %s", softStr)
+	}
+	hard, err := strconv.ParseUint(hardStr, 10, 64)
+	if err != nil {
+		return Rlimit{}, errors.Wrapf(err, "invalid ulimit hard value %s", hardStr)
+	}
+	if soft > hard {
+		return Rlimit{}, fmt.Errorf("ulimit soft value %d is larger than hard value %d", soft, hard)
+	}
+
+	return Rlimit{Type: typ, Soft: soft, Hard: hard}, nil
+}
+
+// 父进程持有的Pipe端
+// specW: 写入 InitSpec; syncR: 读取init进程的初始化结果
+type InitPipe struct {
+	specW      *os.File
+	syncR      *os.File
+	childFiles []*os.File
+}
+
+func newInitPipe() (*InitPipe, error) {
+	specR, specW, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "create spec pipe failed")
+	}
+	syncR, syncW, err := os.Pipe()
+	if err != nil {
+		specR.Close()
+		specW.Close()
+		return nil, errors.Wrap(err, "create sync pipe failed")
+	}
+
+	return &InitPipe{
+		specW:      specW,
+		syncR:      syncR,
+		childFiles: []*os.File{specR, syncW},
+	}, nil
+}
+
+// 发送启动配置，并等待init进程初始化完成
+// init进程在exec用户命令前出错时会写回错误信息，成功exec后同步Pipe自动关闭
+func (p *InitPipe) Send(spec *InitSpec) error {
+	// 子进程已经继承了另一端，父进程需关闭才能在子进程退出或exec后读到EOF
+	p.closeChildFiles()
+	defer p.syncR.Close()
+
+	err := json.NewEncoder(p.specW).Encode(spec)
+	_ = p.specW.Close()
+	if err != nil {
+		return errors.Wrap(err, "send init spec failed")
+	}
+
+	content, err := io.ReadAll(p.syncR)
+	if err != nil {
+		return errors.Wrap(err, "read init result failed")
+	}
+	if len(content) == 0 {
+		return nil
+	}
+
+	msg := new(syncMessage)
+	if err = json.Unmarshal(content, msg); err != nil {
+		return errors.Wrapf(err, "unmarshal init result %q failed", content)
+	}
+	return errors.New(msg.Error)
+}
+
+// 容器进程未能启动时释放所有Pipe
+func (p *InitPipe) Close() {
+	p.closeChildFiles()
+	_ = p.specW.Close()
+	_ = p.syncR.Close()
+}
+
+func (p *InitPipe) closeChildFiles() {
+	for _, f := range p.childFiles {
+		_ = f.Close()
+	}
+	p.childFiles = nil
+}
+
+// init进程读取父进程传递的启动配置
+func readInitSpec() (*InitSpec, error) {
+	pipe := os.NewFile(uintptr(specPipeFd), "spec-pipe")
+	defer pipe.Close()
+
+	// Pipe为空时，子进程阻塞
+	spec := new(InitSpec)
+	if err := json.NewDecoder(pipe).Decode(spec); err != nil {
+		return nil, errors.Wrap(err, "decode init spec failed")
+	}
+	if spec.Version != InitSpecVersion {
+		return nil, fmt.Errorf("unsupported init spec version %d", spec.Version)
+	}
+	if len(spec.Args) == 0 {
+		return nil, errors.New("missing container command")
+	}
+	return spec, nil
+}
+
+// init进程将初始化错误写回父进程
+func reportInitError(initErr error) {
+	pipe := os.NewFile(uintptr(syncPipeFd), "sync-pipe")
+	defer pipe.Close()
+	_ = json.NewEncoder(pipe).Encode(&syncMessage{Error: initErr.Error()})
+}
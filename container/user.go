@@ -0,0 +1,108 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 在容器的rootfs中解析得到的运行用户
+type ExecUser struct {
+	Uid    int
+	Gid    int
+	Groups []int
+	Home   string
+}
+
+// 解析 user[:group]，user 与 group 可以是名称或数字id
+// 名称通过容器内的 /etc/passwd 与 /etc/group 查找，需在 pivot_root 之后调用
+func LookupUser(userSpec string) (*ExecUser, error) {
+	execUser := &ExecUser{Home: "/"}
+	if userSpec == "" {
+		return execUser, nil
+	}
+
+	userStr, groupStr, hasGroup := strings.Cut(userSpec, ":")
+	passwd, _ := readColonFile("/etc/passwd")
+	groups, _ := readColonFile("/etc/group")
+
+	found := false
+	for _, entry := range passwd {
+		// root:x:0:0:root:/root:/bin/sh
+		if len(entry) < 6 || (entry[0] != userStr && entry[2] != userStr) {
+			continue
+		}
+		execUser.Uid, _ = strconv.Atoi(entry[2])
+		execUser.Gid, _ = strconv.Atoi(entry[3])
+		execUser.Home = entry[5]
+		userStr = entry[0]
+		found = true
+		break
+	}
+	if !found {
+		uid, err := strconv.Atoi(userStr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find user %s", userStr)
+		}
+		execUser.Uid = uid
+	}
+
+	if hasGroup {
+		gid, err := lookupGroup(groups, groupStr)
+		if err != nil {
+			return nil, err
+		}
+		execUser.Gid = gid
+		return execUser, nil
+	}
+
+	// 未指定组时加入用户所属的附加组
+	for _, entry := range groups {
+		// wheel:x:10:root,admin
+		if len(entry) < 4 {
+			continue
+		}
+		for _, member := range strings.Split(entry[3], ",") {
+			if member == userStr {
+				gid, _ := strconv.Atoi(entry[2])
+				execUser.Groups = append(execUser.Groups, gid)
+			}
+		}
+	}
+	return execUser, nil
+}
+
+func lookupGroup(groups [][]string, groupStr string) (int, error) {
+	for _, entry := range groups {
+		if len(entry) >= 3 && (entry[0] == groupStr || entry[2] == groupStr) {
+			return strconv.Atoi(entry[2])
+		}
+	}
+	gid, err := strconv.Atoi(groupStr)
+	if err != nil {
+		return 0, fmt.Errorf("unable to find group %s", groupStr)
+	}
+	return gid, nil
+}
+
+// 读取 /etc/passwd 格式的文件，按冒号分割每一行
+func readColonFile(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries [][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, strings.Split(line, ":"))
+	}
+	return entries, scanner.Err()
+}
@@ -58,3 +58,22 @@ func umountVolume(mntPath, containerPath string) {
 		logrus.Errorf("umount volume fail, err: %v", err)
 	}
 }
+
+type MountPoint struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"`      // 宿主机路径
+	Destination string `json:"destination"` // 容器内路径
+}
+
+// 容器挂载的 volume 列表
+func GetMountPoints(info *Info) []MountPoint {
+	if info.Volume == "" {
+		return nil
+	}
+	hostPath, containerPath, err := volumeParse(info.Volume)
+	if err != nil {
+		logrus.Errorf("parse volume %s failed, err: %v", info.Volume, err)
+		return nil
+	}
+	return []MountPoint{{Type: "bind", Source: hostPath, Destination: containerPath}}
+}
@@ -0,0 +1,62 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	WaitNotRunning = "not-running" // 等待容器不处于运行状态
+	WaitNextExit   = "next-exit"   // 等待容器下一次退出
+	WaitRemoved    = "removed"     // 等待容器被删除
+
+	waitInterval = 100 * time.Millisecond
+)
+
+// 轮询 InfoLoc 下的容器信息，阻塞直到容器满足指定条件，返回容器最近一次的退出码
+func WaitContainer(containerID, condition string) (int, error) {
+	switch condition {
+	case WaitNotRunning, WaitNextExit, WaitRemoved:
+	default:
+		return -1, fmt.Errorf("invalid wait condition %s", condition)
+	}
+
+	info, err := GetContainerInfo(containerID)
+	if err != nil {
+		return -1, fmt.Errorf("no such container: %s", containerID)
+	}
+	// 重启策略下容器可能在两次轮询之间退出并重新运行，因此通过退出序号判断是否发生了新的退出
+	lastExit := info.ExitSeq
+
+	for {
+		switch condition {
+		case WaitNotRunning:
+			if !isActive(info) {
+				return info.ExitCode, nil
+			}
+		case WaitNextExit:
+			if info.ExitSeq != lastExit {
+				return info.ExitCode, nil
+			}
+		}
+
+		time.Sleep(waitInterval)
+		latest, err := GetContainerInfo(containerID)
+		if err != nil {
+			// 等待期间容器被删除，返回最后一次记录的退出码
+			if os.IsNotExist(errors.Cause(err)) {
+				return info.ExitCode, nil
+			}
+			// 其他错误可能是读到了其他进程正在写入的文件，下一次轮询时重试
+			continue
+		}
+		info = latest
+	}
+}
+
+func isActive(info *Info) bool {
+	return info.Status == RUNNING || info.Status == CREATED || info.Status == PAUSED
+}
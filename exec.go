@@ -3,68 +3,187 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"mydocker/cgroups"
 	"mydocker/container"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 
 	_ "mydocker/nsenter"
+	"mydocker/utils"
 
+	"github.com/creack/pty"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+// nsenter 通过环境变量获取需要进入的容器进程、namespace与cgroup
 const (
-	EnvExecPid = "mydocker_pid"
-	EnvExecCmd = "mydocker_cmd"
+	EnvExecPid        = "mydocker_pid"
+	EnvExecNamespaces = "mydocker_ns"
+	EnvExecCgroup     = "mydocker_cgroup"
 )
 
-func ExecContainer(containerID string, cmdArr []string) {
-	pid, err := getPidByContainerID(containerID)
+type ExecOptions struct {
+	Tty        bool     // 分配伪终端并连接宿主机终端
+	Detach     bool     // 后台运行，不等待命令退出
+	User       string   // 运行用户，默认为容器的运行用户
+	WorkingDir string   // 工作目录，默认为容器的工作目录
+	Env        []string // 额外的环境变量
+	Namespaces []string // 需要进入的namespace
+}
+
+// 在运行中的容器内执行命令，返回命令的退出码，被信号杀死时为 128+信号值
+// exec 进程在Go运行时启动前由 nsenter 加入容器的cgroup与namespace，再以子进程运行用户命令
+func ExecContainer(containerID string, cmdArr []string, opts *ExecOptions) (int, error) {
+	info, err := getRunningContainerInfo(containerID)
 	if err != nil {
-		log.Error(err)
-		return
+		return -1, err
 	}
 
-	cmd := exec.Command("/proc/self/exe", "exec")
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	// 使用容器init进程的环境变量，不继承宿主机的环境变量
+	containerEnvs, err := getEnvByPID(info.Pid)
+	if err != nil {
+		return -1, errors.Wrap(err, "get container env failed")
+	}
+	spec := container.NewExecSpec(info, cmdArr, containerEnvs, opts.Env, opts.User, opts.WorkingDir, opts.Tty)
 
-	cmdStr := strings.Join(cmdArr, " ")
-	log.Infof("container pid: %s, cmd: %s", pid, cmdStr)
-	// 通过环境变量为cgo中constructor函数传递参数
-	// os.Setenv 设置的环境变量只会影响当前进程和子进程
-	_ = os.Setenv(EnvExecPid, pid)
-	_ = os.Setenv(EnvExecCmd, cmdStr)
+	specR, specW, err := os.Pipe()
+	if err != nil {
+		return -1, errors.Wrap(err, "create exec pipe failed")
+	}
+	defer specW.Close()
 
-	// 将指定容器内的环境变量传递给新进程
-	containerEnvs, err := getEnvByPID(pid)
+	cmd := exec.Command("/proc/self/exe", "nsexec")
+	cmd.ExtraFiles = []*os.File{specR}
+	cmd.Env = []string{
+		EnvExecPid + "=" + info.Pid,
+		EnvExecNamespaces + "=" + strings.Join(opts.Namespaces, ","),
+	}
+	cgroupDir, err := setExecCgroup(cmd, info)
 	if err != nil {
-		log.Errorf("get env failed, %v", err)
-	} else {
-		cmd.Env = append(os.Environ(), containerEnvs...)
+		specR.Close()
+		return -1, err
+	}
+	if cgroupDir != nil {
+		defer cgroupDir.Close()
 	}
 
-	if err = cmd.Run(); err != nil {
-		log.Errorf("exec container %s err %v", containerID, err)
+	var slave *os.File
+	var proxy *utils.TerminalProxy
+	switch {
+	case opts.Detach:
+		// 后台运行的 exec 进程脱离当前会话，输出被丢弃
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Setsid = true
+	case opts.Tty:
+		var master *os.File
+		master, slave, err = pty.Open()
+		if err != nil {
+			specR.Close()
+			return -1, errors.Wrap(err, "allocate pty failed")
+		}
+		defer slave.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+		if proxy, err = utils.NewTerminalProxy(master); err != nil {
+			master.Close()
+			specR.Close()
+			return -1, err
+		}
+	default:
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
 	}
+
+	log.Infof("container pid: %s, cmd: %q", info.Pid, cmdArr)
+	err = cmd.Start()
+	specR.Close()
+	if err != nil {
+		if proxy != nil {
+			slave.Close()
+			proxy.Close()
+		}
+		return -1, errors.Wrap(err, "start exec process failed")
+	}
+	if err = json.NewEncoder(specW).Encode(spec); err != nil {
+		_ = cmd.Process.Kill()
+	}
+	specW.Close()
+
+	if opts.Detach {
+		if err != nil {
+			_ = cmd.Wait()
+			return -1, errors.Wrap(err, "send exec spec failed")
+		}
+		log.Infof("exec process %d started in container %s", cmd.Process.Pid, containerID)
+		return 0, cmd.Process.Release()
+	}
+
+	waitErr := cmd.Wait()
+	if proxy != nil {
+		// 关闭父进程持有的 slave 端，使输出转发在读完剩余数据后结束
+		slave.Close()
+		proxy.Close()
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "send exec spec failed")
+	}
+	if waitErr != nil {
+		if _, ok := waitErr.(*exec.ExitError); !ok {
+			return -1, errors.Wrap(waitErr, "wait exec process failed")
+		}
+	}
+	return exitStatus(cmd.ProcessState), nil
+}
+
+// exec 进程需要在执行用户命令前加入容器的cgroup
+// cgroup v2 下通过 CLONE_INTO_CGROUP 在创建进程时直接放入容器cgroup，
+// 其他情况由 nsenter 在进入namespace前将自身写入各 hierarchy 的 cgroup.procs
+func setExecCgroup(cmd *exec.Cmd, info *container.Info) (*os.File, error) {
+	cgroupDir, err := cgroups.OpenCgroupDir(info.CgroupDriver, info.CgroupPath)
+	if err != nil {
+		return nil, err
+	}
+	if cgroupDir != nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: int(cgroupDir.Fd())}
+		return cgroupDir, nil
+	}
+
+	var procs []string
+	for _, p := range cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath).Paths() {
+		procs = append(procs, filepath.Join(p, "cgroup.procs"))
+	}
+	sort.Strings(procs)
+	cmd.Env = append(cmd.Env, EnvExecCgroup+"="+strings.Join(procs, ":"))
+	return nil, nil
 }
 
-func getPidByContainerID(containerID string) (string, error) {
+func getRunningContainerInfo(containerID string) (*container.Info, error) {
 	infoFilePath := filepath.Join(container.InfoLoc, containerID, container.ConfigName)
 	content, err := os.ReadFile(infoFilePath)
 	if err != nil {
-		return "", errors.WithMessagef(err, "read config file %s failed", infoFilePath)
+		return nil, errors.WithMessagef(err, "read config file %s failed", infoFilePath)
 	}
 
 	containerInfo := new(container.Info)
 	if err := json.Unmarshal(content, containerInfo); err != nil {
-		return "", errors.WithMessage(err, "json unmarshal failed")
+		return nil, errors.WithMessage(err, "json unmarshal failed")
+	}
+	// 冻结的容器中无法执行命令
+	if containerInfo.Status == container.PAUSED {
+		return nil, errors.Errorf("container %s is paused, unpause it first", containerID)
+	}
+	if containerInfo.Status != container.RUNNING {
+		return nil, errors.Errorf("container %s is not running, status: %s", containerID, containerInfo.Status)
 	}
 
-	return containerInfo.Pid, nil
+	return containerInfo, nil
 }
 
 func getEnvByPID(pid string) ([]string, error) {
@@ -74,6 +193,6 @@ func getEnvByPID(pid string) ([]string, error) {
 		return nil, err
 	}
 
-	envs := strings.Split(string(content), "\u0000")
+	envs := strings.Split(strings.TrimRight(string(content), "\u0000"), "\u0000")
 	return envs, nil
 }
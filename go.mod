@@ -3,12 +3,16 @@ module mydocker
 go 1.22.5
 
 require (
+	github.com/coreos/go-systemd/v22 v22.5.0
+	github.com/creack/pty v1.1.18
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.9.3
 	github.com/urfave/cli/v2 v2.27.5
 	github.com/vishvananda/netlink v1.3.0
 	github.com/vishvananda/netns v0.0.4
 	golang.org/x/sys v0.10.0
+	golang.org/x/term v0.10.0
 )
 
 require (
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"mydocker/cgroups"
+	"mydocker/cgroups/resource"
+	"mydocker/container"
+	"mydocker/network"
+	"mydocker/utils"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 容器的完整信息，在 config.json 记录的基础上补充文件系统、cgroup、网络等派生信息
+type ContainerInspect struct {
+	*container.Info
+	LogPath         string                    `json:"logpath"`
+	CgroupPaths     map[string]string         `json:"cgrouppaths"`
+	Pids            *resource.PidsStats       `json:"pids,omitempty"`
+	GraphDriver     GraphDriver               `json:"graphdriver"`
+	Mounts          []container.MountPoint    `json:"mounts"`
+	NetworkSettings *network.EndpointSettings `json:"networksettings"`
+}
+
+type GraphDriver struct {
+	Name      string `json:"name"`
+	LowerDir  string `json:"lowerdir"`
+	UpperDir  string `json:"upperdir"`
+	WorkDir   string `json:"workdir"`
+	MergedDir string `json:"mergeddir"`
+}
+
+func inspectContainer(ref string) (*ContainerInspect, error) {
+	info, err := container.ResolveContainer(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	inspect := &ContainerInspect{
+		Info:    info,
+		LogPath: filepath.Join(container.InfoLoc, info.Id, container.GetLogFile(info.Id)),
+		GraphDriver: GraphDriver{
+			Name:      "overlay2",
+			LowerDir:  utils.GetLower(info.Id),
+			UpperDir:  utils.GetUpper(info.Id),
+			WorkDir:   utils.GetWork(info.Id),
+			MergedDir: utils.GetMerged(info.Id),
+		},
+		Mounts: container.GetMountPoints(info),
+	}
+	if info.CgroupPath != "" {
+		cgroupManager := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath)
+		inspect.CgroupPaths = cgroupManager.Paths()
+		// 只有运行中的容器有cgroup
+		if info.Status == container.RUNNING || info.Status == container.PAUSED {
+			if inspect.Pids, err = cgroupManager.PidsStats(); err != nil {
+				log.Warnf("get pids stats of container %s failed, %v", info.Id, err)
+			}
+		}
+	}
+
+	inspect.NetworkSettings, err = network.GetEndpointSettings(info)
+	if err != nil {
+		log.Warnf("get network settings of container %s failed, %v", info.Id, err)
+	}
+	return inspect, nil
+}
+
+// 输出多个对象的信息，未指定 format 时以JSON数组输出
+func printInspect(objects []any, format string) error {
+	if format == "" {
+		return utils.WriteJSON(os.Stdout, objects)
+	}
+	for _, obj := range objects {
+		if err := utils.ExecuteTemplate(os.Stdout, format, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
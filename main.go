@@ -4,6 +4,8 @@ import (
 	"io"
 	"os"
 
+	"mydocker/cgroups"
+
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2" // imports as package "cli"
 )
@@ -20,20 +22,45 @@ func main() {
 	app.Name = NAME
 	app.Usage = USAGE
 
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:  "cgroup-driver",
+			Usage: "driver to manage container cgroups, cgroupfs or systemd",
+			Value: cgroups.DriverCgroupfs,
+		},
+	}
+
 	app.Commands = []*cli.Command{
 		&runCommand,
 		&initCommand,
+		&monitorCommand,
 		&commitCommand,
 		&listCommand,
 		&logCommand,
 		&execCommand,
+		&attachCommand,
+		&nsexecCommand,
 		&stopCommand,
+		&killCommand,
 		&removeCommand,
 		&networkCommand,
 		&startCommand,
+		&waitCommand,
+		&inspectCommand,
+		&pauseCommand,
+		&unpauseCommand,
+		&updateCommand,
+		&statsCommand,
 	}
 
 	app.Before = func(c *cli.Context) error {
+		// exec 进程已进入容器的mount namespace，日志只输出到标准错误，避免写入容器的文件系统与命令的输出
+		if os.Getenv(EnvExecPid) != "" {
+			log.SetOutput(os.Stderr)
+			log.SetLevel(log.WarnLevel)
+			return nil
+		}
+
 		_ = os.MkdirAll("logs", os.ModePerm)
 		file, _ := os.OpenFile("logs/runtime.out", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 
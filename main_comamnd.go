@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -11,13 +13,14 @@ import (
 	"mydocker/cgroups/resource"
 	"mydocker/container"
 	"mydocker/network"
+	"mydocker/utils"
 )
 
 var runCommand = cli.Command{
 	Name: "run",
 	Usage: `Create a container 
 	        mydocker run -it [command]`,
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:  "name",
 			Usage: "specify container name",
@@ -26,17 +29,15 @@ var runCommand = cli.Command{
 			Name:  "it",
 			Usage: "enable tty",
 		},
-		&cli.StringFlag{
-			Name:  "mem",
-			Usage: "limit memory, e.g., -mem 100m",
-		},
-		&cli.IntFlag{
-			Name:  "cpu",
-			Usage: "limit cpu, e.g., -cpu 100",
+		&cli.BoolFlag{
+			Name:    "interactive",
+			Aliases: []string{"i"},
+			Usage:   "keep stdin open for attach even if the container has no tty",
 		},
 		&cli.StringFlag{
-			Name:  "cpuset",
-			Usage: "limit cpuset, e.g., -cpuset 0,1",
+			Name:  "detach-keys",
+			Value: utils.DefaultDetachKeys,
+			Usage: "key sequence to detach from a foreground container, e.g., --detach-keys ctrl-x,x",
 		},
 		&cli.StringFlag{
 			Name:  "v",
@@ -58,7 +59,45 @@ var runCommand = cli.Command{
 			Name:  "p",
 			Usage: "port mapping, e.g., -p 8080:80 -p 6000:60",
 		},
-	},
+		&cli.StringFlag{
+			Name:  "hostname",
+			Usage: "container hostname, default is container id",
+		},
+		&cli.StringFlag{
+			Name:  "u",
+			Usage: "user to run command, e.g., -u nobody or -u 1000:1000",
+		},
+		&cli.StringFlag{
+			Name:  "w",
+			Usage: "working directory inside the container, e.g., -w /tmp",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ulimit",
+			Usage: "ulimit of container process, e.g., --ulimit nofile=1024:2048",
+		},
+		&cli.StringFlag{
+			Name:  "restart",
+			Value: container.RestartNo,
+			Usage: "restart policy: no, on-failure[:max-retries], always or unless-stopped",
+		},
+		&cli.StringFlag{
+			Name:  "stop-signal",
+			Value: "SIGTERM",
+			Usage: "signal to stop the container, e.g., --stop-signal SIGINT",
+		},
+		&cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "set metadata on container, e.g., --label env=prod",
+		},
+		&cli.StringFlag{
+			Name:  "cgroup-parent",
+			Usage: "parent cgroup for the container, a slice name with systemd driver, e.g., --cgroup-parent team-a.slice",
+		},
+		&cli.StringFlag{
+			Name:  "cgroupns",
+			Usage: "cgroup namespace to use, private or host, default private on cgroup v2 and host on cgroup v1",
+		},
+	}, append(resourceFlags(), createResourceFlags()...)...),
 	Action: func(c *cli.Context) error {
 		// c.Args() 不包括flag相关参数
 		if c.Args().Len() < 2 {
@@ -66,27 +105,87 @@ var runCommand = cli.Command{
 		}
 
 		tty := c.Bool("it")
-		detach := c.Bool("d")
-		// 实际运行中只依靠-it来判断是否后台运行
-		if tty && detach {
-			return fmt.Errorf("it and d parameter can not be both provided")
+		// 未指定 -it 的容器始终后台运行，-it -d 则在后台运行带伪终端的容器，之后可以 attach
+		detach := c.Bool("d") || !tty
+		if _, err := utils.ParseDetachKeys(c.String("detach-keys")); err != nil {
+			return err
+		}
+
+		resCfg, err := parseResourceFlags(c)
+		if err != nil {
+			return err
+		}
+		if _, err = resCfg.ParseMemory(); err != nil {
+			return err
+		}
+		if err = resCfg.ValidateCpu(); err != nil {
+			return err
+		}
+
+		if _, err := utils.ParseSignal(c.String("stop-signal")); err != nil {
+			return err
 		}
 
-		resCfg := &resource.ResourceConfig{
-			MemoryLimit: c.String("mem"),
-			CpuSet:      c.String("cpuset"),
-			CpuCfsQuota: c.Int("cpu"),
+		cgroupNs, err := container.ParseCgroupNs(c.String("cgroupns"))
+		if err != nil {
+			return err
 		}
 
-		volume := c.String("v")
-		containerName := c.String("name")
-		envSlice := c.StringSlice("e")
-		imageName := c.Args().First()
-		netName := c.String("net")
-		portMapping := c.StringSlice("p")
+		restartPolicy, err := container.ParseRestartPolicy(c.String("restart"))
+		if err != nil {
+			return err
+		}
+		// 前台容器退出后会被删除，不能重启
+		if !detach && restartPolicy.Name != container.RestartNo {
+			return fmt.Errorf("restart policy can only be used with detached container")
+		}
+
+		var rlimits []container.Rlimit
+		for _, ulimit := range c.StringSlice("ulimit") {
+			rlimit, err := container.ParseRlimit(ulimit)
+			if err != nil {
+				return err
+			}
+			rlimits = append(rlimits, rlimit)
+		}
+
+		labels := make(map[string]string)
+		for _, label := range c.StringSlice("label") {
+			key, value, _ := strings.Cut(label, "=")
+			if key == "" {
+				return fmt.Errorf("invalid label %s", label)
+			}
+			labels[key] = value
+		}
 
-		Run(tty, c.Args().Tail(), envSlice, resCfg, volume, containerName, imageName, netName, portMapping)
+		containerInfo := &container.Info{
+			Name:        c.String("name"),
+			Image:       c.Args().First(),
+			CmdArray:    c.Args().Tail(),
+			Env:         c.StringSlice("e"),
+			Volume:      c.String("v"),
+			NetworkName: c.String("net"),
+			PortMapping: c.StringSlice("p"),
+			Hostname:    c.String("hostname"),
+			User:        c.String("u"),
+			WorkingDir:  c.String("w"),
+			Rlimits:     rlimits,
+			Labels:      labels,
+			StopSignal:  c.String("stop-signal"),
+			Tty:         tty,
+			OpenStdin:   tty || c.Bool("interactive"),
+			Resource:    resCfg,
 
+			RestartPolicy: restartPolicy,
+			// 全局参数 --cgroup-driver
+			CgroupDriver: c.String("cgroup-driver"),
+			CgroupParent: c.String("cgroup-parent"),
+			CgroupNs:     cgroupNs,
+		}
+
+		if code := Run(detach, c.String("detach-keys"), containerInfo); code != 0 {
+			return cli.Exit("", code)
+		}
 		return nil
 	},
 }
@@ -97,10 +196,64 @@ var initCommand = cli.Command{
 			command directly`,
 	Action: func(c *cli.Context) error {
 		log.Info("Init container ...")
-		// cmd := c.Args().Get(0)
 
-		_ = container.RunContainerInitProcess()
+		// 正常情况下用户命令会通过exec覆盖当前进程，返回即说明初始化失败
+		return container.RunContainerInitProcess()
+	},
+}
+
+var monitorCommand = cli.Command{
+	Name: "monitor",
+	Usage: `Start a container and wait for it to exit, do not use this
+			command directly`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "attach",
+			Usage: "keep output until the first client attaches",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if len(c.Args().Slice()) < 1 {
+			return errors.New("monitor command missing container id")
+		}
+		return runMonitor(c.Args().First(), c.Bool("attach"))
+	},
+}
+
+var attachCommand = cli.Command{
+	Name: "attach",
+	Usage: `Attach to a running container's stdin, stdout and stderr
+			mydocker attach [--detach-keys ctrl-p,ctrl-q] [container]`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "detach-keys",
+			Value: utils.DefaultDetachKeys,
+			Usage: "key sequence to detach from the container",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.Args().Len() < 1 {
+			return errors.New("missing container id")
+		}
+		containerID, err := container.ResolveContainerID(c.Args().First())
+		if err != nil {
+			return err
+		}
 
+		code, err := AttachContainer(containerID, c.String("detach-keys"))
+		if err == utils.ErrDetached {
+			return nil
+		}
+		// 没有收到退出帧时(e.g., 客户端读取过慢被断开)从容器信息中读取退出码
+		if err == container.ErrAttachClosed {
+			code, err = container.WaitContainer(containerID, container.WaitNotRunning)
+		}
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return cli.Exit("", code)
+		}
 		return nil
 	},
 }
@@ -112,7 +265,10 @@ var commitCommand = cli.Command{
 		if len(c.Args().Slice()) < 2 {
 			return fmt.Errorf("commit missing container id or image name")
 		}
-		containerID := c.Args().Get(0)
+		containerID, err := container.ResolveContainerID(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
 		imageName := c.Args().Get(1)
 		container.CommitContainer(containerID, imageName)
 
@@ -122,10 +278,39 @@ var commitCommand = cli.Command{
 
 var listCommand = cli.Command{
 	Name:  "ps",
-	Usage: "list all containers",
+	Usage: "list containers, e.g., mydocker ps -a --filter status=exited",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "a",
+			Usage: "show all containers, only running containers are shown by default",
+		},
+		&cli.BoolFlag{
+			Name:  "q",
+			Usage: "only display container IDs",
+		},
+		&cli.StringSliceFlag{
+			Name:    "filter",
+			Aliases: []string{"f"},
+			Usage:   "filter output by id, name, image, network, label, status or exited, e.g., --filter label=env=prod",
+		},
+		&cli.IntFlag{
+			Name:    "last",
+			Aliases: []string{"n"},
+			Usage:   "show n last created containers, includes all states",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: table, json or a Go template, e.g., --format '{{.Id}} {{.Status}}'",
+		},
+	},
 	Action: func(c *cli.Context) error {
-		container.ListContainers()
-		return nil
+		return container.ListContainers(container.ListOptions{
+			All:     c.Bool("a"),
+			Quiet:   c.Bool("q"),
+			Last:    c.Int("last"),
+			Filters: c.StringSlice("filter"),
+			Format:  c.String("format"),
+		})
 	},
 }
 
@@ -136,7 +321,10 @@ var logCommand = cli.Command{
 		if len(c.Args().Slice()) < 1 {
 			return errors.New("logs command lacks container ID")
 		}
-		containerID := c.Args().Get(0)
+		containerID, err := container.ResolveContainerID(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
 		container.OutputContainerLog(containerID)
 		return nil
 	},
@@ -144,37 +332,141 @@ var logCommand = cli.Command{
 
 var execCommand = cli.Command{
 	Name:  "exec",
-	Usage: "enter a container and exec a command",
+	Usage: "run a command in a running container, e.g., mydocker exec -it {containerID} sh",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "it",
+			Usage: "allocate a pseudo-TTY and keep stdin attached",
+		},
+		&cli.BoolFlag{
+			Name:    "detach",
+			Aliases: []string{"d"},
+			Usage:   "run the command in background",
+		},
+		&cli.StringFlag{
+			Name:    "user",
+			Aliases: []string{"u"},
+			Usage:   "run as user[:group], default to the user of the container",
+		},
+		&cli.StringFlag{
+			Name:    "workdir",
+			Aliases: []string{"w"},
+			Usage:   "working directory inside the container, default to the working directory of the container",
+		},
+		&cli.StringSliceFlag{
+			Name:    "env",
+			Aliases: []string{"e"},
+			Usage:   "set environment variables, e.g., -e KEY=VALUE",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ns",
+			Value: cli.NewStringSlice(container.ExecNamespaces...),
+			Usage: "namespaces of the container to join, e.g., --ns net,mnt",
+		},
+	},
 	Action: func(c *cli.Context) error {
-		if os.Getenv(EnvExecPid) != "" {
-			log.Infof("pid callback pid %v", os.Getgid())
-			return nil
-		}
-
 		if len(c.Args().Slice()) < 2 {
 			return errors.New("exec command missing container id or command")
 		}
-		containerID := c.Args().Get(0)
-		var cmdArr []string
-		cmdArr = append(cmdArr, c.Args().Tail()...)
-		ExecContainer(containerID, cmdArr)
+		if c.Bool("it") && c.Bool("detach") {
+			return errors.New("it and d parameter can not be both provided")
+		}
+		containerID, err := container.ResolveContainerID(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+
+		// 支持 --ns net,mnt 与 --ns net --ns mnt 两种写法
+		var namespaces []string
+		for _, ns := range c.StringSlice("ns") {
+			namespaces = append(namespaces, strings.Split(ns, ",")...)
+		}
+		if namespaces, err = container.ParseExecNamespaces(namespaces); err != nil {
+			return err
+		}
+
+		code, err := ExecContainer(containerID, c.Args().Tail(), &ExecOptions{
+			Tty:        c.Bool("it"),
+			Detach:     c.Bool("detach"),
+			User:       c.String("user"),
+			WorkingDir: c.String("workdir"),
+			Env:        c.StringSlice("env"),
+			Namespaces: namespaces,
+		})
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return cli.Exit("", code)
+		}
 		return nil
 	},
 }
 
+var nsexecCommand = cli.Command{
+	Name: "nsexec",
+	Usage: `Run a command inside the namespaces of a container, do not use this
+			command directly`,
+	Action: func(c *cli.Context) error {
+		// 正常情况下用户命令会通过exec覆盖当前进程，返回即说明执行失败
+		// 与 shell 一致，命令不存在时退出码为 127，无法执行时为 126
+		err := container.RunExecProcess()
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return cli.Exit(err.Error(), 127)
+		}
+		return cli.Exit(err.Error(), 126)
+	},
+}
+
 var stopCommand = cli.Command{
 	Name:  "stop",
-	Usage: "stop a container, e.g., mydocker stop {containerID}",
+	Usage: "stop a container, e.g., mydocker stop -t 10 {containerID}",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "t",
+			Value: DefaultStopTimeout,
+			Usage: "seconds to wait for stop before killing it",
+		},
+	},
 	Action: func(c *cli.Context) error {
 		if len(c.Args().Slice()) < 1 {
 			return errors.New("stop command missing container id")
 		}
-		containerID := c.Args().Get(0)
-		stopContainer(containerID)
+		containerID, err := container.ResolveContainerID(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		stopContainer(containerID, c.Int("t"))
 		return nil
 	},
 }
 
+var killCommand = cli.Command{
+	Name:  "kill",
+	Usage: "send a signal to a container, e.g., mydocker kill -s SIGHUP {containerID}",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "s",
+			Value: "SIGKILL",
+			Usage: "signal to send, name or number",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if len(c.Args().Slice()) < 1 {
+			return errors.New("kill command missing container id")
+		}
+		sig, err := utils.ParseSignal(c.String("s"))
+		if err != nil {
+			return err
+		}
+		containerID, err := container.ResolveContainerID(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		return killContainer(containerID, sig)
+	},
+}
+
 var removeCommand = cli.Command{
 	Name:  "rm",
 	Usage: "remove container with container ID, e.g., mydocker rm {containerID}",
@@ -188,7 +480,10 @@ var removeCommand = cli.Command{
 		if len(c.Args().Slice()) < 1 {
 			return errors.New("rm command missing container id")
 		}
-		containerID := c.Args().Get(0)
+		containerID, err := container.ResolveContainerID(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
 		force := c.Bool("f")
 		removeContainer(containerID, force)
 		return nil
@@ -237,6 +532,31 @@ var networkCommand = cli.Command{
 				return nil
 			},
 		},
+		{
+			Name:  "inspect",
+			Usage: "display detailed information of networks",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "format",
+					Aliases: []string{"f"},
+					Usage:   "format output using a Go template, e.g., --format '{{.Subnet}}'",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if len(c.Args().Slice()) < 1 {
+					return errors.New("missing network name")
+				}
+				var objects []any
+				for _, name := range c.Args().Slice() {
+					inspect, err := network.InspectNetwork(name)
+					if err != nil {
+						return errors.WithMessagef(err, "inspect network %s failed", name)
+					}
+					objects = append(objects, inspect)
+				}
+				return printInspect(objects, c.String("format"))
+			},
+		},
 		{
 			Name:  "remove",
 			Usage: "remove container networks",
@@ -259,17 +579,327 @@ var startCommand = cli.Command{
 	Name:  "start",
 	Usage: "start a stopped container and run it in background",
 	Action: func(c *cli.Context) error {
-		if os.Getenv(EnvStart) != "" {
-			container.StartContainerInitProcess()
-		}
-
 		if len(c.Args().Slice()) < 1 {
 			return errors.New("start command missing container id")
 		}
 
-		containerID := c.Args().First()
+		containerID, err := container.ResolveContainerID(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
 		startContainer(containerID)
 
 		return nil
 	},
 }
+
+var waitCommand = cli.Command{
+	Name:  "wait",
+	Usage: "block until containers stop and print their exit codes, e.g., mydocker wait {containerID}",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "condition",
+			Value: container.WaitNotRunning,
+			Usage: "wait condition: not-running, next-exit or removed",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if len(c.Args().Slice()) < 1 {
+			return errors.New("wait command missing container id")
+		}
+
+		// 依次等待所有容器，并以第一个容器的退出码退出
+		condition := c.String("condition")
+		firstCode := 0
+		for i, ref := range c.Args().Slice() {
+			containerID, err := container.ResolveContainerID(ref)
+			if err != nil {
+				return err
+			}
+			code, err := container.WaitContainer(containerID, condition)
+			if err != nil {
+				return err
+			}
+			fmt.Println(code)
+			if i == 0 {
+				firstCode = code
+			}
+		}
+		if firstCode != 0 {
+			return cli.Exit("", firstCode)
+		}
+		return nil
+	},
+}
+
+var inspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information of containers, e.g., mydocker inspect {containerID}",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "format",
+			Aliases: []string{"f"},
+			Usage:   "format output using a Go template, e.g., --format '{{.IP}}'",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if len(c.Args().Slice()) < 1 {
+			return errors.New("inspect command missing container id")
+		}
+		var objects []any
+		for _, containerID := range c.Args().Slice() {
+			inspect, err := inspectContainer(containerID)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, inspect)
+		}
+		return printInspect(objects, c.String("format"))
+	},
+}
+
+var pauseCommand = cli.Command{
+	Name:  "pause",
+	Usage: "pause all processes within containers, e.g., mydocker pause {containerID}",
+	Action: func(c *cli.Context) error {
+		if len(c.Args().Slice()) < 1 {
+			return errors.New("pause command missing container id")
+		}
+		for _, ref := range c.Args().Slice() {
+			containerID, err := container.ResolveContainerID(ref)
+			if err != nil {
+				return err
+			}
+			if err = pauseContainer(containerID); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var unpauseCommand = cli.Command{
+	Name:  "unpause",
+	Usage: "unpause all processes within containers, e.g., mydocker unpause {containerID}",
+	Action: func(c *cli.Context) error {
+		if len(c.Args().Slice()) < 1 {
+			return errors.New("unpause command missing container id")
+		}
+		for _, ref := range c.Args().Slice() {
+			containerID, err := container.ResolveContainerID(ref)
+			if err != nil {
+				return err
+			}
+			if err = unpauseContainer(containerID); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var updateCommand = cli.Command{
+	Name:  "update",
+	Usage: "update resource limits of containers, e.g., mydocker update -mem 200m {containerID}",
+	Flags: append(resourceFlags(), []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "update memory limit even if it is below current usage",
+		},
+	}...),
+	Action: func(c *cli.Context) error {
+		if len(c.Args().Slice()) < 1 {
+			return errors.New("update command missing container id")
+		}
+
+		resCfg, err := parseResourceFlags(c)
+		if err != nil {
+			return err
+		}
+		for _, ref := range c.Args().Slice() {
+			containerID, err := container.ResolveContainerID(ref)
+			if err != nil {
+				return err
+			}
+			if err = updateContainer(containerID, resCfg, c.Bool("force")); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// run 与 update 共用的资源限制参数
+func resourceFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "mem",
+			Usage: "limit memory, e.g., -mem 100m",
+		},
+		&cli.StringFlag{
+			Name:  "memory-swap",
+			Usage: "limit of memory plus swap, -1 for unlimited swap, e.g., --memory-swap 200m",
+		},
+		&cli.StringFlag{
+			Name:  "memory-reservation",
+			Usage: "memory soft limit, e.g., --memory-reservation 50m",
+		},
+		&cli.StringFlag{
+			Name:  "kernel-memory",
+			Usage: "kernel memory limit, only supported by cgroup v1, e.g., --kernel-memory 50m",
+		},
+		&cli.IntFlag{
+			Name:  "cpu",
+			Usage: "limit cpu, e.g., -cpu 100",
+		},
+		&cli.StringFlag{
+			Name:  "cpuset",
+			Usage: "limit cpuset, e.g., -cpuset 0,1",
+		},
+		&cli.StringFlag{
+			Name:  "cpuset-mems",
+			Usage: "memory nodes allowed to use, e.g., --cpuset-mems 0",
+		},
+		&cli.Float64Flag{
+			Name:  "cpus",
+			Usage: "number of cpus, e.g., --cpus 1.5",
+		},
+		&cli.Uint64Flag{
+			Name:  "cpu-period",
+			Usage: "limit CPU CFS period in microseconds, e.g., --cpu-period 100000",
+		},
+		&cli.Int64Flag{
+			Name:  "cpu-quota",
+			Usage: "limit CPU CFS quota in microseconds, -1 for unlimited, e.g., --cpu-quota 50000",
+		},
+		&cli.Uint64Flag{
+			Name:  "cpu-shares",
+			Usage: "CPU shares (relative weight), e.g., --cpu-shares 512",
+		},
+		&cli.Uint64Flag{
+			Name:  "cpu-rt-period",
+			Usage: "limit CPU real-time period in microseconds, only supported by cgroup v1",
+		},
+		&cli.Int64Flag{
+			Name:  "cpu-rt-runtime",
+			Usage: "limit CPU real-time runtime in microseconds, only supported by cgroup v1",
+		},
+		&cli.Int64Flag{
+			Name:  "pids-limit",
+			Usage: "limit number of processes, -1 for unlimited, e.g., --pids-limit 100",
+		},
+		&cli.UintFlag{
+			Name:  "blkio-weight",
+			Usage: "block IO relative weight, between 10 and 1000, e.g., --blkio-weight 500",
+		},
+	}
+}
+
+// 只能在创建容器时设置的资源限制参数
+func createResourceFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "oom-kill-disable",
+			Usage: "disable OOM killer, only supported by cgroup v1",
+		},
+		&cli.StringSliceFlag{
+			Name:  "hugetlb-limit",
+			Usage: "limit huge pages of a page size, e.g., --hugetlb-limit 2MB:1g",
+		},
+		&cli.StringSliceFlag{
+			Name:  "device-read-bps",
+			Usage: "limit read rate from a device, e.g., --device-read-bps /dev/sda:1mb",
+		},
+		&cli.StringSliceFlag{
+			Name:  "device-write-bps",
+			Usage: "limit write rate to a device, e.g., --device-write-bps /dev/sda:1mb",
+		},
+		&cli.StringSliceFlag{
+			Name:  "device-read-iops",
+			Usage: "limit read IO per second from a device, e.g., --device-read-iops /dev/sda:1000",
+		},
+		&cli.StringSliceFlag{
+			Name:  "device-write-iops",
+			Usage: "limit write IO per second to a device, e.g., --device-write-iops /dev/sda:1000",
+		},
+	}
+}
+
+// 根据资源限制参数生成 ResourceConfig，命令中未定义的参数按未设置处理
+func parseResourceFlags(c *cli.Context) (*resource.ResourceConfig, error) {
+	res := &resource.ResourceConfig{
+		MemoryLimit:       c.String("mem"),
+		MemorySwap:        c.String("memory-swap"),
+		MemoryReservation: c.String("memory-reservation"),
+		KernelMemory:      c.String("kernel-memory"),
+		OomKillDisable:    c.Bool("oom-kill-disable"),
+		CpuSet:            c.String("cpuset"),
+		CpuSetMems:        c.String("cpuset-mems"),
+		CpuCfsQuota:       c.Int("cpu"),
+		CpuPeriod:         c.Uint64("cpu-period"),
+		CpuQuota:          c.Int64("cpu-quota"),
+		CpuShares:         c.Uint64("cpu-shares"),
+		CpuRtPeriod:       c.Uint64("cpu-rt-period"),
+		CpuRtRuntime:      c.Int64("cpu-rt-runtime"),
+		PidsLimit:         c.Int64("pids-limit"),
+		BlkioWeight:       uint16(c.Uint("blkio-weight")),
+	}
+
+	if err := parseCpusFlag(c, res); err != nil {
+		return nil, err
+	}
+	if res.PidsLimit < -1 {
+		return nil, fmt.Errorf("invalid pids limit %d", res.PidsLimit)
+	}
+	if weight := c.Uint("blkio-weight"); weight != 0 && (weight < 10 || weight > 1000) {
+		return nil, fmt.Errorf("invalid blkio weight %d, should be between 10 and 1000", weight)
+	}
+	var err error
+	if res.BlkioDeviceReadBps, err = resource.ParseThrottleDevices(c.StringSlice("device-read-bps"), true); err != nil {
+		return nil, err
+	}
+	if res.BlkioDeviceWriteBps, err = resource.ParseThrottleDevices(c.StringSlice("device-write-bps"), true); err != nil {
+		return nil, err
+	}
+	if res.BlkioDeviceReadIOps, err = resource.ParseThrottleDevices(c.StringSlice("device-read-iops"), false); err != nil {
+		return nil, err
+	}
+	if res.BlkioDeviceWriteIOps, err = resource.ParseThrottleDevices(c.StringSlice("device-write-iops"), false); err != nil {
+		return nil, err
+	}
+	if res.HugetlbLimits, err = resource.ParseHugetlbLimits(c.StringSlice("hugetlb-limit")); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// --cpus 与 --cpu-period、--cpu-quota 及 -cpu 不能同时使用，按默认周期转换为 quota
+func parseCpusFlag(c *cli.Context, res *resource.ResourceConfig) error {
+	if !c.IsSet("cpus") {
+		return nil
+	}
+	if c.IsSet("cpu-period") || c.IsSet("cpu-quota") || c.IsSet("cpu") {
+		return errors.New("cpus conflicts with cpu-period, cpu-quota and cpu")
+	}
+	quota, err := resource.CpusToQuota(c.Float64("cpus"))
+	if err != nil {
+		return err
+	}
+	res.CpuPeriod = resource.CpuPeriodDefault
+	res.CpuQuota = quota
+	return nil
+}
+
+var statsCommand = cli.Command{
+	Name:  "stats",
+	Usage: "display resource usage of containers, e.g., mydocker stats --no-stream {containerID}",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-stream",
+			Usage: "print a JSON snapshot of stats and exit instead of a refreshing table",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		return statsContainers(c.Args().Slice(), c.Bool("no-stream"))
+	},
+}
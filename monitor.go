@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+
+	"mydocker/cgroups"
+	"mydocker/container"
+	"mydocker/network"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// monitor 进程中用于向 CLI 返回启动结果的 Pipe
+const monitorReadyFd = 3
+
+const (
+	restartBackoffMin   = 100 * time.Millisecond
+	restartBackoffMax   = time.Minute
+	restartBackoffReset = 10 * time.Second
+)
+
+// 容器运行期间检查OOM计数的间隔
+const oomWatchInterval = time.Second
+
+var errRestartCanceled = errors.New("restart canceled")
+
+type monitorResult struct {
+	Pid   int    `json:"pid"`
+	Error string `json:"error"`
+}
+
+// 为容器启动监控进程，并等待容器启动完成，返回容器init进程的PID
+// 监控进程负责创建容器init进程，持有其标准输入输出，等待其退出并记录退出状态
+// attach 为 true 时 CLI 随后会 attach 到容器，监控进程保留在此之前的输出
+func startMonitor(containerID string, attach bool) (int, error) {
+	rPipe, wPipe, err := os.Pipe()
+	if err != nil {
+		return 0, errors.Wrap(err, "create monitor pipe failed")
+	}
+	defer rPipe.Close()
+
+	args := []string{"monitor"}
+	if attach {
+		args = append(args, "--attach")
+	}
+	cmd := exec.Command("/proc/self/exe", append(args, containerID)...)
+	// 监控进程脱离当前会话，CLI 退出或终端关闭后继续运行
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.ExtraFiles = []*os.File{wPipe}
+	if err = cmd.Start(); err != nil {
+		wPipe.Close()
+		return 0, errors.Wrap(err, "start monitor process failed")
+	}
+	wPipe.Close()
+
+	result := new(monitorResult)
+	if err = json.NewDecoder(rPipe).Decode(result); err != nil {
+		_ = cmd.Wait()
+		return 0, errors.Wrap(err, "monitor process exited unexpectedly")
+	}
+	if result.Error != "" {
+		_ = cmd.Wait()
+		return 0, errors.New(result.Error)
+	}
+
+	logrus.Infof("container %s started, pid: %d, monitor pid: %d", containerID, result.Pid, cmd.Process.Pid)
+	return result.Pid, cmd.Process.Release()
+}
+
+// 监控进程的入口: 创建容器进程并一直等待到其退出
+// 容器退出后按照重启策略以指数退避的方式重新启动容器
+// 运行期间通过 attach socket 向客户端转发容器的输入输出，重启时客户端保持连接
+func runMonitor(containerID string, attach bool) error {
+	readyPipe := os.NewFile(uintptr(monitorReadyFd), "ready-pipe")
+	syscall.CloseOnExec(monitorReadyFd)
+
+	var parent *exec.Cmd
+	var server *container.ConsoleServer
+	var oomBefore uint64
+	info, err := container.GetContainerInfo(containerID)
+	if err == nil {
+		server, err = container.NewConsoleServer(info, attach)
+	}
+	if err == nil {
+		oomBefore, _ = cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath).OOMKillCount()
+		info.MonitorPid = strconv.Itoa(os.Getpid())
+		parent, err = launchWithConsole(info, server)
+	}
+
+	result := new(monitorResult)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Pid = parent.Process.Pid
+	}
+	_ = json.NewEncoder(readyPipe).Encode(result)
+	_ = readyPipe.Close()
+	if err != nil {
+		if server != nil {
+			server.Close()
+		}
+		return err
+	}
+
+	// 容器不再重启时将最后一次的退出码通知给 attach 的客户端
+	exitCode := -1
+	defer func() {
+		server.Exit(exitCode)
+		server.Close()
+	}()
+
+	backoff := restartBackoffMin
+	for {
+		startedAt := time.Now()
+		cgroupManager := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath)
+		stopWatch := watchOOMKills(containerID, cgroupManager, oomBefore)
+		exitCode = waitContainer(parent)
+		recorded := stopWatch()
+		oomAfter, err := cgroupManager.OOMKillCount()
+		if err != nil {
+			// systemd 会在容器进程全部退出后回收scope，此时只能使用运行期间记录的计数
+			oomAfter = oomBefore + recorded
+		}
+		// 容器退出后转发剩余的输出
+		server.WaitOutput()
+		logrus.Infof("container %s exited with code %d", containerID, exitCode)
+
+		restart := false
+		err = cleanupExitedContainer(containerID, func(info *container.Info) {
+			info.ExitCode = exitCode
+			info.OOMKilled = oomAfter > oomBefore
+			if info.OOMKilled {
+				info.OOMKillCount = oomAfter - oomBefore
+			}
+			info.MonitorPid = ""
+			if info.ManuallyStopped {
+				info.Status = container.STOP
+				return
+			}
+			info.Status = container.EXITED
+			if info.ShouldRestart() {
+				info.Status = container.RESTARTING
+				info.MonitorPid = strconv.Itoa(os.Getpid())
+				restart = true
+			}
+		})
+		if err != nil || !restart {
+			return err
+		}
+
+		// 容器稳定运行一段时间后重置退避时间
+		if time.Since(startedAt) >= restartBackoffReset {
+			backoff = restartBackoffMin
+		}
+		logrus.Infof("restart container %s in %v", containerID, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, restartBackoffMax)
+
+		oomBefore = oomAfter
+		parent, err = relaunchContainer(containerID, server)
+		if err == errRestartCanceled {
+			return nil
+		}
+		if err != nil {
+			logrus.Errorf("restart container %s failed, %v", containerID, err)
+			return container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+				info.Status = container.EXITED
+				info.MonitorPid = ""
+				return nil
+			})
+		}
+	}
+}
+
+// 容器运行期间轮询cgroup中的OOM计数，容器内有进程因OOM被杀死时立即记录到容器信息中，
+// 使容器内的子进程被杀死而容器仍在运行时也能通过 inspect 查看，返回的函数用于停止轮询并返回已记录的计数
+func watchOOMKills(containerID string, cgroupManager cgroups.CgroupManager, base uint64) func() uint64 {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	var recorded uint64
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(oomWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			count, err := cgroupManager.OOMKillCount()
+			if err != nil || count <= base+recorded {
+				continue
+			}
+			recorded = count - base
+			logrus.Warnf("%d processes in container %s have been killed by OOM killer", recorded, containerID)
+			err = container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+				info.OOMKillCount = recorded
+				return nil
+			})
+			if err != nil {
+				logrus.Errorf("record oom kills of container %s failed, %v", containerID, err)
+			}
+		}
+	}()
+
+	return func() uint64 {
+		close(done)
+		<-finished
+		return recorded
+	}
+}
+
+// 为容器的本次启动创建标准输入输出并启动容器，监控进程只保留其父进程端
+func launchWithConsole(info *container.Info, server *container.ConsoleServer) (*exec.Cmd, error) {
+	stdio, err := server.NewStdio()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := launchContainer(info, stdio)
+	stdio.Close()
+	if err != nil {
+		// 容器进程未能启动，子进程端全部关闭后输出转发随之结束
+		server.WaitOutput()
+	}
+	return parent, err
+}
+
+// 在退避等待结束后重新启动容器，等待期间容器被stop或删除时放弃重启
+func relaunchContainer(containerID string, server *container.ConsoleServer) (*exec.Cmd, error) {
+	var parent *exec.Cmd
+	err := container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		if info.Status != container.RESTARTING {
+			return errRestartCanceled
+		}
+		info.RestartCount++
+		info.MonitorPid = strconv.Itoa(os.Getpid())
+
+		var err error
+		parent, err = launchWithConsole(info, server)
+		return err
+	})
+	if parent != nil {
+		if err != nil {
+			logrus.Errorf("update container %s info failed, %v", containerID, err)
+		}
+		return parent, nil
+	}
+	if err == errRestartCanceled || os.IsNotExist(errors.Cause(err)) {
+		return nil, errRestartCanceled
+	}
+	return nil, err
+}
+
+// 等待容器进程退出并返回退出码，被信号杀死时返回 128+信号值
+func waitContainer(parent *exec.Cmd) int {
+	if err := parent.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			logrus.Errorf("wait container process failed, %v", err)
+		}
+	}
+	return exitStatus(parent.ProcessState)
+}
+
+func exitStatus(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return state.ExitCode()
+}
+
+// 容器进程退出后的清理工作: 断开网络释放IP，清空PID，记录退出时间
+// update 用于在同一把锁内更新容器状态
+func cleanupExitedContainer(containerID string, update func(info *container.Info)) error {
+	return container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		if info.NetworkName != "" && info.IP != "" {
+			if err := network.Disconnect(info); err != nil {
+				logrus.Errorf("disconnect from [%s] failed, %v", info.NetworkName, err)
+			}
+		}
+		info.IP = ""
+		info.Pid = ""
+		info.FinishedTime = time.Now().Format("2006-01-02 15:04:05")
+		info.ExitSeq++
+		update(info)
+		return nil
+	})
+}
@@ -64,13 +64,14 @@ func (b *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) erro
 		return errors.Wrapf(err, "retrieve bridge %s failed", bridgeName)
 	}
 
+	hostVeth, containerVeth := vethNames(endpoint.ID)
 	la := netlink.NewLinkAttrs()
-	la.Name = endpoint.ID[:5]
+	la.Name = hostVeth
 	// 设置Veth的master属性，veth的一端挂载到对应的Bridge
 	la.MasterIndex = br.Attrs().Index
 	endpoint.Device = netlink.Veth{
 		LinkAttrs: la,
-		PeerName:  "cif-" + endpoint.ID[:5], // veth 另一端的名字
+		PeerName:  containerVeth, // veth 另一端的名字
 	}
 
 	if err = netlink.LinkAdd(&endpoint.Device); err != nil {
@@ -85,7 +86,7 @@ func (b *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) erro
 
 // 关于Veth的删除：通过测试发现在容器进程结束后的一段时间内veth会自动被删除
 func (b *BridgeNetworkDriver) Disconnect(endpoint *Endpoint) error {
-	vethName := endpoint.ID[:5]
+	vethName, vPeerName := vethNames(endpoint.ID)
 	veth, err := netlink.LinkByName(vethName)
 	if err != nil {
 		return errors.Wrapf(err, "retrieve veth [%s] failed", vethName)
@@ -99,7 +100,6 @@ func (b *BridgeNetworkDriver) Disconnect(endpoint *Endpoint) error {
 	if err = netlink.LinkDel(veth); err != nil {
 		return errors.Wrapf(err, "delete veth [%s] failed", vethName)
 	}
-	vPeerName := fmt.Sprintf("cif-%s", vethName)
 	vethPeer, err := netlink.LinkByName(vPeerName)
 	if err != nil {
 		return errors.Wrapf(err, "retrieve veth [%s] failed", vPeerName)
@@ -112,6 +112,12 @@ func (b *BridgeNetworkDriver) Disconnect(endpoint *Endpoint) error {
 	return nil
 }
 
+// Endpoint 对应的 veth pair 的名字，宿主机一端取 Endpoint ID 的前5位，容器一端加上 cif- 前缀
+func vethNames(epID string) (string, string) {
+	hostVeth := epID[:5]
+	return hostVeth, "cif-" + hostVeth
+}
+
 func (b *BridgeNetworkDriver) initBridge(n *Network) error {
 	// create bridge
 	bridgeName := n.Name
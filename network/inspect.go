@@ -0,0 +1,115 @@
+package network
+
+import (
+	"fmt"
+	"mydocker/container"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// 容器在网络中的端点信息
+type EndpointSettings struct {
+	NetworkName   string        `json:"network"`
+	EndpointID    string        `json:"endpointid"`
+	IPAddress     string        `json:"ip"`
+	Gateway       string        `json:"gateway"`
+	Subnet        string        `json:"subnet"`
+	HostVeth      string        `json:"hostveth"`      // veth 在宿主机中的一端，挂载在 bridge 上
+	ContainerVeth string        `json:"containerveth"` // veth 在容器中的一端
+	Ports         []PortBinding `json:"ports"`
+}
+
+type PortBinding struct {
+	HostPort      string `json:"hostport"`
+	ContainerPort string `json:"containerport"`
+	Protocol      string `json:"protocol"`
+}
+
+type NetworkInspect struct {
+	Name       string                       `json:"name"`
+	Driver     string                       `json:"driver"`
+	Subnet     string                       `json:"subnet"`
+	Gateway    string                       `json:"gateway"`
+	Containers map[string]*EndpointSettings `json:"containers"` // 以容器ID为key
+}
+
+// 根据容器信息获取其网络端点，容器未接入网络时返回 nil
+func GetEndpointSettings(info *container.Info) (*EndpointSettings, error) {
+	if info.NetworkName == "" {
+		return nil, nil
+	}
+
+	networks, err := loadNetworks()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load networks failed")
+	}
+	n, ok := networks[info.NetworkName]
+	if !ok {
+		return nil, fmt.Errorf("retrieve network %s failed", info.NetworkName)
+	}
+	return newEndpointSettings(n, info), nil
+}
+
+func newEndpointSettings(n *Network, info *container.Info) *EndpointSettings {
+	epID := endpointID(info.Id, n.Name)
+	_, subnet, _ := net.ParseCIDR(n.IPRange.String())
+
+	settings := &EndpointSettings{
+		NetworkName: n.Name,
+		EndpointID:  epID,
+		IPAddress:   info.IP,
+		Gateway:     n.IPRange.IP.String(),
+		Subnet:      subnet.String(),
+	}
+	// 容器未运行时没有 veth 设备
+	if info.IP != "" {
+		settings.HostVeth, settings.ContainerVeth = vethNames(epID)
+	}
+
+	for _, pm := range info.PortMapping {
+		hostPort, containerPort, ok := strings.Cut(pm, ":")
+		if !ok {
+			continue
+		}
+		settings.Ports = append(settings.Ports, PortBinding{
+			HostPort:      hostPort,
+			ContainerPort: containerPort,
+			Protocol:      "tcp",
+		})
+	}
+	return settings
+}
+
+// 获取网络信息以及接入该网络的所有容器
+func InspectNetwork(name string) (*NetworkInspect, error) {
+	networks, err := loadNetworks()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load networks failed")
+	}
+	n, ok := networks[name]
+	if !ok {
+		return nil, fmt.Errorf("retrieve network %s failed", name)
+	}
+
+	_, subnet, _ := net.ParseCIDR(n.IPRange.String())
+	inspect := &NetworkInspect{
+		Name:       n.Name,
+		Driver:     n.Driver,
+		Subnet:     subnet.String(),
+		Gateway:    n.IPRange.IP.String(),
+		Containers: map[string]*EndpointSettings{},
+	}
+
+	infos, err := container.GetAllContainerInfos()
+	if err != nil {
+		return nil, errors.WithMessage(err, "load containers failed")
+	}
+	for _, info := range infos {
+		if info.NetworkName == name {
+			inspect.Containers[info.Id] = newEndpointSettings(n, info)
+		}
+	}
+	return inspect, nil
+}
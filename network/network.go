@@ -175,6 +175,11 @@ func DeleteNetwork(name string) error {
 	return n.remove(defaultNetworkPath)
 }
 
+// 容器在指定网络中的 Endpoint ID，veth 的名字由它生成
+func endpointID(containerID, networkName string) string {
+	return fmt.Sprintf("%s-%s", containerID, networkName)
+}
+
 // 将容器接入指定网络
 func Connect(networkName string, info *container.Info) (net.IP, error) {
 	networks, err := loadNetworks()
@@ -193,7 +198,7 @@ func Connect(networkName string, info *container.Info) (net.IP, error) {
 	}
 
 	ep := &Endpoint{
-		ID:          fmt.Sprintf("%s-%s", info.Id, networkName),
+		ID:          endpointID(info.Id, networkName),
 		IPAddr:      ip,
 		Network:     n,
 		PortMapping: info.PortMapping,
@@ -226,7 +231,7 @@ func Disconnect(info *container.Info) error {
 
 	ip := net.ParseIP(info.IP)
 	ep := &Endpoint{
-		ID:          fmt.Sprintf("%s-%s", info.Id, networkName),
+		ID:          endpointID(info.Id, networkName),
 		Network:     n,
 		PortMapping: info.PortMapping,
 		IPAddr:      ip,
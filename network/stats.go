@@ -0,0 +1,52 @@
+package network
+
+import (
+	"fmt"
+	"mydocker/container"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+)
+
+// 容器网卡的流量统计
+type InterfaceStats struct {
+	RxBytes   uint64 `json:"rxbytes"`
+	RxPackets uint64 `json:"rxpackets"`
+	RxErrors  uint64 `json:"rxerrors"`
+	RxDropped uint64 `json:"rxdropped"`
+	TxBytes   uint64 `json:"txbytes"`
+	TxPackets uint64 `json:"txpackets"`
+	TxErrors  uint64 `json:"txerrors"`
+	TxDropped uint64 `json:"txdropped"`
+}
+
+// 通过宿主机一端的 veth 读取容器网卡的流量，无需进入容器的 network namespace
+// veth 宿主机一端的发送即为容器一端的接收，以容器中的网卡名为 key，容器未接入网络时返回 nil
+func GetInterfaceStats(info *container.Info) (map[string]*InterfaceStats, error) {
+	if info.NetworkName == "" || info.IP == "" {
+		return nil, nil
+	}
+
+	hostVeth, containerVeth := vethNames(endpointID(info.Id, info.NetworkName))
+	link, err := netlink.LinkByName(hostVeth)
+	if err != nil {
+		return nil, errors.Wrapf(err, "retrieve veth [%s] failed", hostVeth)
+	}
+	s := link.Attrs().Statistics
+	if s == nil {
+		return nil, fmt.Errorf("no statistics of veth [%s]", hostVeth)
+	}
+
+	return map[string]*InterfaceStats{
+		containerVeth: {
+			RxBytes:   s.TxBytes,
+			RxPackets: s.TxPackets,
+			RxErrors:  s.TxErrors,
+			RxDropped: s.TxDropped,
+			TxBytes:   s.RxBytes,
+			TxPackets: s.RxPackets,
+			TxErrors:  s.RxErrors,
+			TxDropped: s.RxDropped,
+		},
+	}, nil
+}
@@ -6,52 +6,121 @@
 #include <stdlib.h>
 #include <string.h>
 #include <fcntl.h>
+#include <signal.h>
+#include <sys/wait.h>
+
+static pid_t exec_child;
+
+// 将收到的信号转发给子进程
+static void forward_signal(int sig) {
+	if (exec_child > 0) {
+		kill(exec_child, sig);
+	}
+}
+
+// 判断逗号分隔的namespace列表中是否包含指定的namespace
+static int contains_namespace(const char *list, const char *ns) {
+	size_t len = strlen(ns);
+	const char *p = list;
+	while (p && *p) {
+		const char *end = strchr(p, ',');
+		size_t n = end ? (size_t)(end - p) : strlen(p);
+		if (n == len && strncmp(p, ns, len) == 0) {
+			return 1;
+		}
+		p = end ? end + 1 : NULL;
+	}
+	return 0;
+}
 
 // 指定函数属性 constructor
 // 这里的代码会在Go代码启动前执行，它会在单线程的C上下文中运行
-// 通过环境变量的方式给 cgo 中的constructor函数传值
+// Go运行时启动后为多线程，无法再通过setns进入 mnt 等namespace
+// 通过环境变量的方式给 cgo 中的constructor函数传值，只有 exec 进程会设置这些环境变量
+// 进入namespace后返回，由Go代码以子进程的方式运行用户命令
 __attribute__((constructor)) void enter_namespace(void) {
 	char *mydocker_pid;
 	mydocker_pid = getenv("mydocker_pid");
-	if (mydocker_pid) {
-		fprintf(stdout, "got mydocker_pid=%s\n", mydocker_pid);
-	} else {
-		fprintf(stdout, "missing mydocker_pid env skip nsenter\n");
-		// 如果没有指定PID就不需要继续执行，直接退出
+	if (!mydocker_pid) {
+		// 如果没有指定PID就不需要继续执行，直接返回
 		return;
 	}
 
-    // 如果没有对应的环境变量就不执行
-    // 只有 exec 命令时才设置环境变量，以此避免其他命令时也执行这段代码
-	char *mydocker_cmd;
-	mydocker_cmd = getenv("mydocker_cmd");
-	if (mydocker_cmd) {
-		fprintf(stdout, "got mydocker_cmd=%s\n", mydocker_cmd);
-	} else {
-		fprintf(stdout, "missing mydocker_cmd env skip nsenter\n");
-		// 如果没有指定命令也是直接退出
-		return;
+	char *mydocker_ns;
+	mydocker_ns = getenv("mydocker_ns");
+	if (!mydocker_ns) {
+		fprintf(stderr, "missing mydocker_ns env\n");
+		exit(1);
+	}
+
+	// 在进入namespace前加入容器的cgroup，此时仍能访问宿主机上的cgroup文件系统
+	// 加入失败时不执行命令，避免exec进程逃逸出容器的资源限制
+	char *mydocker_cgroup;
+	mydocker_cgroup = getenv("mydocker_cgroup");
+	if (mydocker_cgroup) {
+		char *procs = strdup(mydocker_cgroup);
+		char pid[32];
+		snprintf(pid, sizeof(pid), "%d", getpid());
+		char *procs_path;
+		for (procs_path = strtok(procs, ":"); procs_path != NULL; procs_path = strtok(NULL, ":")) {
+			int fd = open(procs_path, O_WRONLY);
+			if (fd == -1 || write(fd, pid, strlen(pid)) == -1) {
+				fprintf(stderr, "join cgroup %s failed: %s\n", procs_path, strerror(errno));
+				exit(1);
+			}
+			close(fd);
+		}
+		free(procs);
 	}
 
 	int i;
 	char nspath[1024];
-	// 需要进入的5种namespace
-	char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
+	// 可以进入的namespace，mnt 需要最后进入，否则无法再访问宿主机 /proc 下的namespace文件
+	char *namespaces[] = { "cgroup", "ipc", "uts", "net", "pid", "mnt" };
 
-	for (i=0; i<5; i++) {
+	for (i=0; i<6; i++) {
+		if (!contains_namespace(mydocker_ns, namespaces[i])) {
+			continue;
+		}
 		// 拼接对应路径，类似于/proc/pid/ns/ipc这样
-		sprintf(nspath, "/proc/%s/ns/%s", mydocker_pid, namespaces[i]);
+		snprintf(nspath, sizeof(nspath), "/proc/%s/ns/%s", mydocker_pid, namespaces[i]);
 		int fd = open(nspath, O_RDONLY);
 		// 执行setns系统调用，进入对应namespace
-		if (setns(fd, 0) == -1) {
+		if (fd == -1 || setns(fd, 0) == -1) {
 			fprintf(stderr, "setns on %s namespace failed: %s\n", namespaces[i], strerror(errno));
-		} else {
-			fprintf(stdout, "setns on %s namespace succeeded\n", namespaces[i]);
+			exit(1);
 		}
 		close(fd);
 	}
-	// 在进入的Namespace中执行指定命令，然后退出
-	int res = system(mydocker_cmd);
-	exit(0);
-	return;
-}
\ No newline at end of file
+
+	// 加入 pid namespace 只对之后创建的子进程生效，且加入后当前进程无法再创建线程，
+	// 因此fork出子进程运行Go代码，父进程转发信号并等待子进程退出，以相同的退出状态退出
+	if (!contains_namespace(mydocker_ns, "pid")) {
+		return;
+	}
+	// 在fork前设置信号处理，避免子进程启动前收到的信号直接结束父进程，子进程中的Go运行时会重新设置信号处理
+	int signals[] = { SIGINT, SIGTERM, SIGHUP, SIGQUIT, SIGUSR1, SIGUSR2 };
+	for (i=0; i<6; i++) {
+		signal(signals[i], forward_signal);
+	}
+	exec_child = fork();
+	if (exec_child == -1) {
+		fprintf(stderr, "fork failed: %s\n", strerror(errno));
+		exit(1);
+	}
+	if (exec_child == 0) {
+		return;
+	}
+
+	int status;
+	while (waitpid(exec_child, &status, 0) == -1) {
+		if (errno != EINTR) {
+			fprintf(stderr, "wait exec process failed: %s\n", strerror(errno));
+			exit(1);
+		}
+	}
+	if (WIFSIGNALED(status)) {
+		exit(128 + WTERMSIG(status));
+	}
+	exit(WEXITSTATUS(status));
+}
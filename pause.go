@@ -0,0 +1,51 @@
+package main
+
+import (
+	"mydocker/cgroups"
+	"mydocker/cgroups/resource"
+	"mydocker/container"
+
+	"github.com/pkg/errors"
+)
+
+// 通过cgroup freezer冻结容器内的所有进程，冻结完成后才将容器标记为 paused
+func pauseContainer(containerID string) error {
+	return container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		if info.Status != container.RUNNING {
+			return errors.Errorf("container %s is not running, status: %s", containerID, info.Status)
+		}
+		if err := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath).Freeze(resource.Frozen); err != nil {
+			return errors.WithMessagef(err, "pause container %s failed", containerID)
+		}
+		info.Status = container.PAUSED
+		return nil
+	})
+}
+
+// 解冻暂停的容器，容器恢复为 running
+func unpauseContainer(containerID string) error {
+	return container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		if info.Status != container.PAUSED {
+			return errors.Errorf("container %s is not paused, status: %s", containerID, info.Status)
+		}
+		if err := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath).Freeze(resource.Thawed); err != nil {
+			return errors.WithMessagef(err, "unpause container %s failed", containerID)
+		}
+		info.Status = container.RUNNING
+		return nil
+	})
+}
+
+// stop 或 rm -f 暂停的容器时，向其发送信号后需要解冻才能使其退出
+func thawPausedContainer(containerID string) error {
+	return container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		if info.Status != container.PAUSED {
+			return nil
+		}
+		if err := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath).Freeze(resource.Thawed); err != nil {
+			return errors.WithMessagef(err, "thaw container %s failed", containerID)
+		}
+		info.Status = container.RUNNING
+		return nil
+	})
+}
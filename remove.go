@@ -7,59 +7,59 @@ import (
 	"path/filepath"
 	"strconv"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 func removeContainer(containerID string, force bool) {
-	containerInfo, err := getInfoByContainerID(containerID)
+	containerInfo, err := container.GetContainerInfo(containerID)
 	if err != nil {
 		log.Error(err)
 		return
 	}
 
 	switch containerInfo.Status {
-	case container.STOP:
-		dirPath := filepath.Join(container.InfoLoc, containerID)
-		if err = os.RemoveAll(dirPath); err != nil {
-			log.Errorf("remove dir %s failed, %v", dirPath, err)
-			return
-		}
-		container.DelWorkSpace(containerID, containerInfo.Volume)
-		if containerInfo.NetworkName != "" {
-			if err = network.Disconnect(containerInfo); err != nil {
-				log.Errorf("disconnect from [%s] failed, %v", containerInfo.NetworkName, err)
-				return
-			}
-		}
-	case container.RUNNING:
+	case container.STOP, container.EXITED:
+	case container.RUNNING, container.PAUSED, container.RESTARTING:
 		if !force {
-			log.Errorf("container {%s} is running, please stop it at first or use [-f]", containerID)
+			log.Errorf("container {%s} is %s, please stop it at first or use [-f]", containerID, containerInfo.Status)
 			return
 		}
-		pidInt, err := strconv.Atoi(containerInfo.Pid)
-		if err != nil {
-			log.Errorf("convert string to int failed, %v", err)
+		// 标记为手动停止，避免监控进程在删除过程中重启容器
+		if containerInfo, err = markManuallyStopped(containerID); err != nil {
+			log.Error(err)
 			return
 		}
-
-		if err = syscall.Kill(pidInt, syscall.SIGTERM); err != nil {
-			log.Errorf("kill process %d failed, %v", pidInt, err)
+		if containerInfo.Status == container.RUNNING || containerInfo.Status == container.PAUSED {
+			// 强制删除时直接发送SIGKILL，等待进程退出后才能删除cgroup
+			if err = killAndWait(containerInfo, syscall.SIGKILL, DefaultStopTimeout*time.Second); err != nil {
+				log.Error(err)
+			}
 		}
-
-		dirPath := filepath.Join(container.InfoLoc, containerID)
-		if err = os.RemoveAll(dirPath); err != nil {
-			log.Errorf("remove dir %s failed, %v", dirPath, err)
+		// 等待监控进程记录容器退出后再删除，避免其写回已删除的容器信息
+		if monitorPid, err := strconv.Atoi(containerInfo.MonitorPid); err == nil {
+			waitProcessExit(monitorPid, DefaultStopTimeout*time.Second)
 		}
-		container.DelWorkSpace(containerID, containerInfo.Volume)
-		if containerInfo.NetworkName != "" {
-			if err = network.Disconnect(containerInfo); err != nil {
-				log.Errorf("disconnect from [%s] failed, %v", containerInfo.NetworkName, err)
-				return
-			}
+		if latest, err := container.GetContainerInfo(containerID); err == nil {
+			containerInfo = latest
 		}
 	default:
 		log.Errorf("couldn't remove container, invalid status: %s", containerInfo.Status)
 		return
 	}
+
+	dirPath := filepath.Join(container.InfoLoc, containerID)
+	if err = os.RemoveAll(dirPath); err != nil {
+		log.Errorf("remove dir %s failed, %v", dirPath, err)
+		return
+	}
+	destroyCgroup(containerInfo)
+	container.DelWorkSpace(containerID, containerInfo.Volume)
+	if containerInfo.NetworkName != "" && containerInfo.IP != "" {
+		if err = network.Disconnect(containerInfo); err != nil {
+			log.Errorf("disconnect from [%s] failed, %v", containerInfo.NetworkName, err)
+			return
+		}
+	}
 }
@@ -2,91 +2,236 @@ package main
 
 import (
 	"os"
+	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"mydocker/cgroups"
 	"mydocker/cgroups/resource"
 	"mydocker/container"
 	"mydocker/network"
+	"mydocker/utils"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
-func Run(tty bool, cmdArray, envSlice []string, res *resource.ResourceConfig, volume, containerName string,
-	imageName, net string, portMapping []string) {
+// 容器未能启动时 run 命令的退出码，与容器内命令的退出码区分
+const runFailedExitCode = 125
+
+// 前台容器运行期间不转发给容器的信号: SIGCHLD 与 SIGWINCH 由 CLI 自身处理，SIGURG 用于 Go 运行时的抢占调度
+var unforwardedSignals = map[os.Signal]bool{
+	syscall.SIGCHLD:  true,
+	syscall.SIGWINCH: true,
+	syscall.SIGURG:   true,
+}
+
+// 根据命令行参数填充的容器信息创建并运行容器
+// 容器均由监控进程创建并持有其标准输入输出，前台运行时 CLI 通过 attach 与容器交互
+// 前台容器返回容器的退出码，被信号杀死时为 128+信号值，后台容器或脱离容器时返回 0
+func Run(detach bool, detachKeys string, containerInfo *container.Info) int {
+	// 容器名需要唯一，否则无法通过名字定位容器
+	if err := container.CheckNameAvailable(containerInfo.Name); err != nil {
+		logrus.Error(err)
+		return runFailedExitCode
+	}
+
+	driver, err := cgroups.ResolveDriver(containerInfo.CgroupDriver)
+	if err != nil {
+		logrus.Error(err)
+		return runFailedExitCode
+	}
 
 	containerID := container.GenerateContainerID()
+	containerInfo.Id = containerID
+	containerInfo.Command = strings.Join(containerInfo.CmdArray, " ")
+	containerInfo.CgroupDriver = driver
+	containerInfo.CgroupPath, err = cgroups.ContainerCgroupPath(driver, containerInfo.CgroupParent, containerID)
+	if err != nil {
+		logrus.Error(err)
+		return runFailedExitCode
+	}
+	volume := containerInfo.Volume
+
+	// 前台容器在创建文件系统前开始接收信号，CLI 不会因信号直接退出而跳过清理
+	// 容器进程启动前收到的信号缓存在 channel 中，启动后转发给容器
+	var sigCh chan os.Signal
+	if !detach {
+		sigCh = make(chan os.Signal, 128)
+		signal.Notify(sigCh)
+		defer signal.Stop(sigCh)
+	}
+
+	// File Systems
+	if err := container.NewWorkSpace(containerID, containerInfo.Image, volume); err != nil {
+		logrus.Errorf("create work space failed, %v", err)
+		return runFailedExitCode
+	}
 
-	parent, wPipe, err := container.NewParentProcessPipe(tty, volume, containerID, imageName, envSlice)
+	containerInfo.Status = container.CREATED
+	err = container.RecordContainerInfo(containerInfo)
+	var pid int
+	if err == nil {
+		// 前台容器的监控进程会保留 attach 前的输出
+		pid, err = startMonitor(containerID, !detach)
+	}
 	if err != nil {
+		logrus.Errorf("start container failed, %v", err)
+		container.DelWorkSpace(containerID, volume)
+		if err := container.DelContainerInfo(containerID); err != nil {
+			logrus.Error(err)
+		}
+		return runFailedExitCode
+	}
+	if detach {
+		return 0
+	}
+
+	go forwardSignals(sigCh, pid)
+	exitCode, err := AttachContainer(containerID, detachKeys)
+	signal.Stop(sigCh)
+	close(sigCh)
+	if err == utils.ErrDetached {
+		// 脱离后容器继续在监控进程下运行，退出后与后台容器一样保留
+		return 0
+	}
+	if err != nil {
+		logrus.Errorf("attach to container failed, %v", err)
+		if exitCode, err = container.WaitContainer(containerID, container.WaitNotRunning); err != nil {
+			// 仍然按前台容器退出的流程清理，清理失败时可以通过 rm -f 手动删除
+			logrus.Errorf("wait for container %s failed, %v", containerID, err)
+			exitCode = runFailedExitCode
+		}
+	}
+
+	// 前台容器退出后删除，监控进程已经断开了容器的网络
+	_ = cgroups.NewCgroupManager(containerInfo.CgroupDriver, containerInfo.CgroupPath).Destroy()
+	container.DelWorkSpace(containerID, volume)
+	if err := container.DelContainerInfo(containerID); err != nil {
 		logrus.Error(err)
-		return
+	}
+	return exitCode
+}
+
+// 将 CLI 收到的信号转发给容器init进程，直到 sigCh 被关闭
+// 容器init进程为 pid namespace 中的1号进程，没有注册处理函数的信号会被内核忽略
+func forwardSignals(sigCh chan os.Signal, pid int) {
+	for sig := range sigCh {
+		if unforwardedSignals[sig] {
+			continue
+		}
+		logrus.Debugf("forward signal %v to container process %d", sig, pid)
+		if err := syscall.Kill(pid, sig.(syscall.Signal)); err != nil && err != syscall.ESRCH {
+			logrus.Warnf("forward signal %v failed, %v", sig, err)
+		}
+	}
+}
+
+// 根据容器信息创建容器进程，并为其配置cgroup与网络，最后记录容器信息
+// run 与 start 共用这一流程，容器的文件系统需要提前准备好
+// stdio 为监控进程为容器创建的标准输入输出
+func launchContainer(info *container.Info, stdio *container.Stdio) (*exec.Cmd, error) {
+	// cgroup控制资源，每个容器使用独立的cgroup
+	// cgroup 的生命周期与容器一致，只在 stop/rm 时销毁
+	// 先创建cgroup并设置资源限制，容器进程创建后立即加入，之后才会执行用户命令
+	res := info.Resource
+	if res == nil {
+		res = &resource.ResourceConfig{}
+	}
+	cgroupManager := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath)
+	if err := cgroupManager.Set(res); err != nil {
+		// 资源限制无法生效时不启动容器
+		_ = cgroupManager.Destroy()
+		return nil, errors.WithMessage(err, "set cgroup failed")
+	}
+
+	parent, initPipe, err := container.NewParentProcessPipe(stdio, info.Id)
+	if err != nil {
+		_ = cgroupManager.Destroy()
+		return nil, errors.WithMessage(err, "create parent process failed")
+	}
+
+	// cgroup v2 下容器进程在创建时就位于容器cgroup中
+	cgroupDir, err := cgroups.OpenCgroupDir(info.CgroupDriver, info.CgroupPath)
+	if err != nil {
+		initPipe.Close()
+		_ = cgroupManager.Destroy()
+		return nil, err
+	}
+	if cgroupDir != nil {
+		defer cgroupDir.Close()
+		parent.SysProcAttr.UseCgroupFD = true
+		parent.SysProcAttr.CgroupFD = int(cgroupDir.Fd())
+		// 同时指定 CLONE_NEWCGROUP 时，新 cgroup namespace 以容器cgroup为根
+		if info.CgroupNs == container.CgroupNsPrivate {
+			parent.SysProcAttr.Cloneflags |= unix.CLONE_NEWCGROUP
+		}
 	}
 
 	if err := parent.Start(); err != nil {
-		logrus.Error(err)
-		return
+		initPipe.Close()
+		_ = cgroupManager.Destroy()
+		return nil, errors.Wrap(err, "start parent process failed")
 	}
 
-	// cgroup控制资源
+	// 其余情况在进程创建后加入cgroup，init进程收到启动配置前不会执行用户命令
 	logrus.Infof("child proc: %d", parent.Process.Pid)
-	cgroupManager := cgroups.NewCgroupManager("mydocker-cgroup")
-	defer cgroupManager.Destroy()
-	_ = cgroupManager.Set(res)
-	_ = cgroupManager.Apply(parent.Process.Pid, res)
+	if err = cgroupManager.Apply(parent.Process.Pid, res); err != nil {
+		// systemd 驱动下 scope 创建失败时容器进程不受任何cgroup管理
+		initPipe.Close()
+		_ = parent.Process.Signal(syscall.SIGKILL)
+		_ = parent.Wait()
+		_ = cgroupManager.Destroy()
+		return nil, errors.WithMessage(err, "apply cgroup failed")
+	}
+
+	info.Pid = strconv.Itoa(parent.Process.Pid)
+	info.Status = container.RUNNING
+	info.StartedTime = time.Now().Format("2006-01-02 15:04:05")
+	info.OOMKillCount = 0
+	info.IP = ""
 
-	var containerIP string
 	// 配置网络
-	if net != "" {
-		containerINFO := &container.Info{
-			Id:          containerID,
-			Name:        containerName,
-			Pid:         strconv.Itoa(parent.Process.Pid),
-			PortMapping: portMapping,
-		}
-		ip, err := network.Connect(net, containerINFO)
+	if info.NetworkName != "" {
+		ip, err := network.Connect(info.NetworkName, info)
 		if err != nil {
-			logrus.Errorf("connect to net %s failed, %v", net, err)
-			container.DelWorkSpace(containerID, volume)
-			err := container.DelContainerInfo(containerID)
-			if err != nil {
-				logrus.Error(err)
-			}
-			return
+			// 子进程仍阻塞在读取Pipe，需要手动结束
+			initPipe.Close()
+			_ = parent.Process.Signal(syscall.SIGKILL)
+			_ = parent.Wait()
+			_ = cgroupManager.Destroy()
+			return nil, errors.WithMessagef(err, "connect to net %s failed", info.NetworkName)
 		}
-		containerIP = ip.String()
+		info.IP = ip.String()
 	}
 
-	info, err := container.RecordContainerInfo(parent.Process.Pid, cmdArray, containerName, containerID, volume, net, containerIP, imageName, portMapping)
-	if err != nil {
+	if err = container.RecordContainerInfo(info); err != nil {
 		logrus.Errorf("record container info failed, err: %v", err)
-		return
 	}
 
 	// 父进程没有向Pipe输入数据时，子进程会阻塞
-	sendInitCmds(cmdArray, wPipe)
-
-	// 如果tty，父进程就需要等到容器进程结束再退出
-	// 否则直接退出
-	if tty {
+	logrus.Infof("Container init command: %q", info.CmdArray)
+	spec := container.NewInitSpec(info, stdio.Console)
+	// 进程创建后才加入容器cgroup时，由init进程在加入后创建 cgroup namespace
+	spec.UnshareCgroupNs = spec.CgroupNs && cgroupDir == nil
+	if err = initPipe.Send(spec); err != nil {
 		_ = parent.Wait()
-		container.DelWorkSpace(containerID, volume)
-		if err := container.DelContainerInfo(containerID); err != nil {
-			logrus.Error(err)
-		}
-		if net != "" {
-			if err = network.Disconnect(info); err != nil {
-				logrus.Errorf("%+v", err)
+		_ = cgroupManager.Destroy()
+		if info.NetworkName != "" {
+			if err := network.Disconnect(info); err != nil {
+				logrus.Errorf("disconnect from [%s] failed, %v", info.NetworkName, err)
 			}
 		}
+		info.Status = container.STOP
+		info.Pid = ""
+		info.IP = ""
+		_ = container.RecordContainerInfo(info)
+		return nil, errors.WithMessage(err, "init container failed")
 	}
 
-}
-
-func sendInitCmds(cmdArray []string, writePipe *os.File) {
-	cmd := strings.Join(cmdArray, " ")
-	logrus.Infof("Container init command: %s", cmd)
-	_, _ = writePipe.Write([]byte(cmd))
-	_ = writePipe.Close()
+	return parent, nil
 }
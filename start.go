@@ -1,74 +1,44 @@
 package main
 
 import (
-	"encoding/json"
 	"mydocker/container"
-	"mydocker/utils"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strconv"
-	"syscall"
 
 	"github.com/sirupsen/logrus"
 )
 
-const (
-	EnvStart = "mydocker_start"
-)
-
+// 按照 config.json 中记录的配置重新启动已停止的容器，
+// 包括启动命令、环境变量、volume、网络与资源限制，容器在监控进程下后台运行
 func startContainer(containerID string) {
-	infoDir := filepath.Join(container.InfoLoc, containerID)
-	_, err := os.Stat(infoDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			logrus.Errorf("can not find container [%s]", containerID)
-		} else {
-			logrus.Errorf("can not check container [%s] status", containerID)
-		}
-	}
-
-	infoFile := filepath.Join(infoDir, container.ConfigName)
-	containerInfo, err := getInfoByContainerID(containerID)
+	containerInfo, err := container.GetContainerInfo(containerID)
 	if err != nil {
 		logrus.Errorf("read container [%s] info failed, err: %v", containerID, err)
+		return
 	}
-
-	// 创建子进程
-	cmd := exec.Command("/proc/self/exe", "start")
-
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWNET | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
-			syscall.CLONE_NEWIPC,
-	}
-
-	logFile := filepath.Join(container.InfoLoc, containerID, container.GetLogFile(containerID))
-	logfd, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		logrus.Errorf("open log file failed, err: %v", err)
+	if containerInfo.Status == container.RUNNING || containerInfo.Status == container.PAUSED ||
+		containerInfo.Status == container.RESTARTING {
+		logrus.Errorf("container [%s] is already %s", containerID, containerInfo.Status)
 		return
 	}
-	cmd.Stdout = logfd
-	cmd.Stderr = logfd
-	cmd.Dir = utils.GetMerged(containerID)
-	cmd.Env = append(os.Environ(), "mydocker_start=true")
 
-	if err := cmd.Start(); err != nil {
-		logrus.Errorf("start container [%s] failed, err; %v", containerID, err)
+	// 重新挂载容器的文件系统
+	if err = container.MountWorkSpace(containerID, containerInfo.Volume); err != nil {
+		logrus.Errorf("mount work space of container [%s] failed, err: %v", containerID, err)
 		return
 	}
 
-	// 修改容器状态
-	containerInfo.Pid = strconv.Itoa(cmd.Process.Pid)
-	containerInfo.Status = container.RUNNING
-	file, err := os.OpenFile(infoFile, os.O_WRONLY|os.O_TRUNC, 0666)
+	// 手动启动后重启策略重新生效
+	err = container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		info.ManuallyStopped = false
+		info.RestartCount = 0
+		return nil
+	})
 	if err != nil {
-		logrus.Errorf("open container information file failed, err: %v", err)
+		logrus.Errorf("update container [%s] info failed, err: %v", containerID, err)
+		return
 	}
-	defer file.Close()
 
-	if err = json.NewEncoder(file).Encode(containerInfo); err != nil {
-		logrus.Errorf("dump into json failed, err: %v", err)
+	if _, err = startMonitor(containerID, false); err != nil {
+		logrus.Errorf("start container [%s] failed, err: %v", containerID, err)
 		return
 	}
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"mydocker/cgroups"
+	"mydocker/cgroups/resource"
+	"mydocker/container"
+	"mydocker/network"
+	"mydocker/utils"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const statsInterval = time.Second
+
+// 容器某一时刻的资源使用情况
+type ContainerStats struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Read string `json:"read"` // 读取统计的时间
+	*resource.Stats
+	Networks map[string]*network.InterfaceStats `json:"networks"`
+
+	readAt time.Time
+}
+
+// 读取运行中容器的cgroup统计与网卡流量
+func collectStats(info *container.Info) (*ContainerStats, error) {
+	if info.Status != container.RUNNING && info.Status != container.PAUSED {
+		return nil, errors.Errorf("container %s is not running, status: %s", info.Id, info.Status)
+	}
+
+	now := time.Now()
+	stats, err := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath).Stats()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "get stats of container %s failed", info.Id)
+	}
+	networks, err := network.GetInterfaceStats(info)
+	if err != nil {
+		log.Warnf("get network stats of container %s failed, %v", info.Id, err)
+	}
+
+	return &ContainerStats{
+		Id:       info.Id,
+		Name:     info.Name,
+		Read:     now.Format(time.RFC3339Nano),
+		Stats:    stats,
+		Networks: networks,
+		readAt:   now,
+	}, nil
+}
+
+// 输出容器的资源使用情况，未指定容器时输出所有运行中的容器
+// noStream 为 true 时以JSON输出一次统计，否则每秒刷新一次表格直到被中断
+func statsContainers(refs []string, noStream bool) error {
+	if noStream {
+		infos, err := statsTargets(refs)
+		if err != nil {
+			return err
+		}
+		objects := make([]*ContainerStats, 0, len(infos))
+		for _, info := range infos {
+			stats, err := collectStats(info)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, stats)
+		}
+		return utils.WriteJSON(os.Stdout, objects)
+	}
+
+	// CPU使用率由相邻两次统计的差值计算
+	previous := make(map[string]*ContainerStats)
+	for {
+		infos, err := statsTargets(refs)
+		if err != nil {
+			return err
+		}
+		current := make(map[string]*ContainerStats, len(infos))
+		var rows []*ContainerStats
+		for _, info := range infos {
+			stats, err := collectStats(info)
+			if err != nil {
+				// 统计期间退出的容器不再展示
+				log.Debugf("skip container %s, %v", info.Id, err)
+				continue
+			}
+			current[info.Id] = stats
+			rows = append(rows, stats)
+		}
+
+		// 清屏并将光标移动到左上角
+		fmt.Print("\033[2J\033[H")
+		if err = writeStatsTable(os.Stdout, rows, previous); err != nil {
+			return err
+		}
+		previous = current
+		time.Sleep(statsInterval)
+	}
+}
+
+// 指定了容器时只统计这些容器，否则统计所有运行中与暂停的容器
+func statsTargets(refs []string) ([]*container.Info, error) {
+	if len(refs) == 0 {
+		infos, err := container.GetAllContainerInfos()
+		if err != nil {
+			return nil, err
+		}
+		var running []*container.Info
+		for _, info := range infos {
+			if info.Status == container.RUNNING || info.Status == container.PAUSED {
+				running = append(running, info)
+			}
+		}
+		return running, nil
+	}
+
+	infos := make([]*container.Info, 0, len(refs))
+	for _, ref := range refs {
+		info, err := container.ResolveContainer(ref)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func writeStatsTable(out io.Writer, rows []*ContainerStats, previous map[string]*ContainerStats) error {
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	_, err := fmt.Fprint(w, "ID\tNAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tNET I/O\tBLOCK I/O\tPIDS\n")
+	if err != nil {
+		return err
+	}
+
+	hostMemory := hostMemoryTotal()
+	for _, s := range rows {
+		cpuPercent := 0.0
+		if prev, ok := previous[s.Id]; ok && s.Cpu.UsageNs >= prev.Cpu.UsageNs {
+			elapsed := s.readAt.Sub(prev.readAt).Nanoseconds()
+			if elapsed > 0 {
+				cpuPercent = float64(s.Cpu.UsageNs-prev.Cpu.UsageNs) / float64(elapsed) * 100
+			}
+		}
+
+		// 未限制内存时以宿主机内存作为上限
+		limit := s.Memory.Limit
+		if limit == 0 || (hostMemory > 0 && limit > hostMemory) {
+			limit = hostMemory
+		}
+		memPercent := 0.0
+		if limit > 0 {
+			memPercent = float64(s.Memory.Usage) / float64(limit) * 100
+		}
+
+		var rx, tx uint64
+		for _, n := range s.Networks {
+			rx += n.RxBytes
+			tx += n.TxBytes
+		}
+
+		_, err = fmt.Fprintf(w, "%s\t%s\t%.2f%%\t%s / %s\t%.2f%%\t%s / %s\t%s / %s\t%d\n",
+			s.Id,
+			s.Name,
+			cpuPercent,
+			utils.HumanSize(s.Memory.Usage), utils.HumanSize(limit),
+			memPercent,
+			utils.HumanSize(rx), utils.HumanSize(tx),
+			utils.HumanSize(s.Io.ReadBytes), utils.HumanSize(s.Io.WriteBytes),
+			s.Pids.Current)
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func hostMemoryTotal() uint64 {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0
+	}
+	return uint64(info.Totalram) * uint64(info.Unit)
+}
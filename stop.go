@@ -1,61 +1,172 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"mydocker/cgroups"
 	"mydocker/container"
-	"os"
-	"path/filepath"
+	"mydocker/utils"
 	"strconv"
 	"syscall"
+	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-func stopContainer(containerID string) {
-	// 查询容器信息
-	containerInfo, err := getInfoByContainerID(containerID)
+const DefaultStopTimeout = 10
+
+// 向容器发送停止信号并等待其退出，超时后发送SIGKILL强制结束
+// 容器进程真正退出后才销毁cgroup并修改容器状态
+func stopContainer(containerID string, timeout int) {
+	// 标记为手动停止，监控进程不会再按重启策略重启容器
+	containerInfo, err := markManuallyStopped(containerID)
 	if err != nil {
 		log.Error(err)
 		return
 	}
-	pidInt, err := strconv.Atoi(containerInfo.Pid)
+
+	// 处于重启等待中的容器没有运行中的进程
+	if containerInfo.Status == container.RUNNING || containerInfo.Status == container.PAUSED {
+		stopSignal := syscall.SIGTERM
+		if containerInfo.StopSignal != "" {
+			if stopSignal, err = utils.ParseSignal(containerInfo.StopSignal); err != nil {
+				log.Errorf("parse stop signal failed, %v", err)
+				return
+			}
+		}
+
+		if err = killAndWait(containerInfo, stopSignal, time.Duration(timeout)*time.Second); err != nil {
+			log.Error(err)
+			return
+		}
+		// 监控进程会在容器退出后记录本次退出，等待其退出，避免同一次退出被记录两次
+		if monitorPid, err := strconv.Atoi(containerInfo.MonitorPid); err == nil {
+			waitProcessExit(monitorPid, DefaultStopTimeout*time.Second)
+		}
+	}
+
+	// 容器停止后销毁其cgroup
+	destroyCgroup(containerInfo)
+
+	// 监控进程已经清空了PID，或者重启等待中的容器在上一次退出时已经完成清理
+	latest, err := container.GetContainerInfo(containerID)
 	if err != nil {
-		log.Errorf("convert string to int failed, %v", err)
+		log.Error(err)
 		return
 	}
-
-	// 发送SIGTERM信号
-	if err = syscall.Kill(pidInt, syscall.SIGTERM); err != nil {
-		log.Errorf("kill process %d failed, %v", pidInt, err)
+	if latest.Pid == "" {
 		return
 	}
 
-	// 修改容器信息: 1. 修改容器状态 2. 清空PID
-	containerInfo.Status = container.STOP
-	containerInfo.Pid = ""
-	newContentBytes, err := json.Marshal(containerInfo)
+	// 没有监控进程记录退出时由 stop 完成清理
+	// 断开网络，释放容器IP，start时重新接入
+	// 修改容器信息: 1. 修改容器状态 2. 清空PID与IP
+	err = cleanupExitedContainer(containerID, func(info *container.Info) {
+		info.Status = container.STOP
+		info.MonitorPid = ""
+	})
 	if err != nil {
-		log.Errorf("json marshal failed, %v", err)
-		return
+		log.Errorf("update container info failed, %v", err)
+	}
+}
+
+// 将运行中、暂停或重启等待中的容器标记为手动停止，返回标记时的容器信息
+// 重启等待中的容器直接标记为 stopped，监控进程将放弃重启
+func markManuallyStopped(containerID string) (*container.Info, error) {
+	var containerInfo *container.Info
+	err := container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		switch info.Status {
+		case container.RUNNING, container.PAUSED, container.RESTARTING:
+		default:
+			return errors.Errorf("container %s is not running, status: %s", containerID, info.Status)
+		}
+		info.ManuallyStopped = true
+		if info.Status == container.RESTARTING {
+			info.Status = container.STOP
+		}
+		containerInfo = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return containerInfo, nil
+}
+
+// 向容器init进程发送信号并等待其退出，超时后发送SIGKILL
+func killAndWait(info *container.Info, sig syscall.Signal, timeout time.Duration) error {
+	pid, err := strconv.Atoi(info.Pid)
+	if err != nil {
+		return errors.Wrap(err, "convert string to int failed")
+	}
+	if err = syscall.Kill(pid, sig); err != nil {
+		if err == syscall.ESRCH {
+			return nil
+		}
+		return errors.Wrapf(err, "kill process %d failed", pid)
+	}
+	// 冻结的进程无法处理信号，发送信号后解冻使其退出
+	if info.Status == container.PAUSED {
+		if err = thawPausedContainer(info.Id); err != nil {
+			return err
+		}
+	}
+	if waitProcessExit(pid, timeout) {
+		return nil
 	}
 
-	// 更新容器信息文件
-	infoFilePath := filepath.Join(container.InfoLoc, containerID, container.ConfigName)
-	if err = os.WriteFile(infoFilePath, newContentBytes, 0622); err != nil {
-		log.Errorf("write file %s failed, %v", infoFilePath, err)
+	log.Warnf("process %d did not exit in %v, kill it with SIGKILL", pid, timeout)
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return errors.Wrapf(err, "kill process %d failed", pid)
 	}
+	if !waitProcessExit(pid, DefaultStopTimeout*time.Second) {
+		return errors.Errorf("process %d is still alive after SIGKILL", pid)
+	}
+	return nil
 }
 
-func getInfoByContainerID(containerID string) (*container.Info, error) {
-	infoFilePath := filepath.Join(container.InfoLoc, containerID, container.ConfigName)
-	content, err := os.ReadFile(infoFilePath)
+// 轮询进程是否退出，进程被其父进程回收后 kill(pid, 0) 返回 ESRCH
+func waitProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// 向容器init进程发送任意信号，容器状态由监控进程在其退出后更新
+func killContainer(containerID string, sig syscall.Signal) error {
+	containerInfo, err := container.GetContainerInfo(containerID)
+	if err != nil {
+		return err
+	}
+	if containerInfo.Status != container.RUNNING && containerInfo.Status != container.PAUSED {
+		return errors.Errorf("container %s is not running, status: %s", containerID, containerInfo.Status)
+	}
+	pidInt, err := strconv.Atoi(containerInfo.Pid)
 	if err != nil {
-		return nil, fmt.Errorf("read file %s failed, %v", infoFilePath, err)
+		return errors.Wrap(err, "convert string to int failed")
+	}
+
+	if err = syscall.Kill(pidInt, sig); err != nil {
+		return errors.Wrapf(err, "send signal %d to process %d failed", sig, pidInt)
+	}
+	// 冻结的进程无法处理信号，与 stop 一样发送信号后解冻
+	if containerInfo.Status == container.PAUSED {
+		return thawPausedContainer(containerID)
+	}
+	return nil
+}
+
+func destroyCgroup(info *container.Info) {
+	if info.CgroupPath == "" {
+		return
 	}
-	info := new(container.Info)
-	if err = json.Unmarshal(content, info); err != nil {
-		return nil, fmt.Errorf("unmarshal json failed, %v", err)
+	if err := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath).Destroy(); err != nil {
+		log.Errorf("destroy cgroup %s failed, %v", info.CgroupPath, err)
 	}
-	return info, nil
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"mydocker/cgroups"
+	"mydocker/cgroups/resource"
+	"mydocker/container"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// 修改容器的资源限制，运行中的容器通过 Subsystem.Set 立即生效，
+// 新的限制写回 config.json，容器重启后依然有效
+// res 中未设置的字段保持原有的限制不变
+func updateContainer(containerID string, res *resource.ResourceConfig, force bool) error {
+	if res.PidsLimit < -1 {
+		return errors.Errorf("invalid pids limit %d", res.PidsLimit)
+	}
+
+	return container.UpdateContainerInfo(containerID, func(info *container.Info) error {
+		updated := &resource.ResourceConfig{}
+		if info.Resource != nil {
+			*updated = *info.Resource
+		}
+		if res.MemoryLimit != "" {
+			updated.MemoryLimit = res.MemoryLimit
+		}
+		if res.MemorySwap != "" {
+			updated.MemorySwap = res.MemorySwap
+		}
+		if res.MemoryReservation != "" {
+			updated.MemoryReservation = res.MemoryReservation
+		}
+		if res.KernelMemory != "" {
+			updated.KernelMemory = res.KernelMemory
+		}
+		// 百分比与 CpuQuota 只保留最后一次设置的一种
+		if res.CpuCfsQuota != 0 {
+			updated.CpuCfsQuota = res.CpuCfsQuota
+			updated.CpuQuota = 0
+		}
+		if res.CpuQuota != 0 {
+			updated.CpuQuota = res.CpuQuota
+			updated.CpuCfsQuota = 0
+		}
+		if res.CpuPeriod != 0 {
+			updated.CpuPeriod = res.CpuPeriod
+		}
+		if res.CpuShares != 0 {
+			updated.CpuShares = res.CpuShares
+		}
+		if res.CpuRtPeriod != 0 {
+			updated.CpuRtPeriod = res.CpuRtPeriod
+		}
+		if res.CpuRtRuntime != 0 {
+			updated.CpuRtRuntime = res.CpuRtRuntime
+		}
+		if res.CpuSet != "" {
+			updated.CpuSet = res.CpuSet
+		}
+		if res.CpuSetMems != "" {
+			updated.CpuSetMems = res.CpuSetMems
+		}
+		if res.PidsLimit != 0 {
+			updated.PidsLimit = res.PidsLimit
+		}
+		if res.BlkioWeight != 0 {
+			updated.BlkioWeight = res.BlkioWeight
+		}
+
+		limits, err := updated.ParseMemory()
+		if err != nil {
+			return err
+		}
+		if err = updated.ValidateCpu(); err != nil {
+			return err
+		}
+
+		// 未运行的容器没有cgroup，只记录新的限制，下次启动时生效
+		if info.Status == container.RUNNING || info.Status == container.PAUSED {
+			cgroupManager := cgroups.NewCgroupManager(info.CgroupDriver, info.CgroupPath)
+			// 内存限制低于当前用量时内核会尝试回收内存，回收失败可能触发OOM
+			if res.MemoryLimit != "" && !force {
+				usage, err := cgroupManager.MemoryUsage()
+				if err != nil {
+					log.Warnf("read memory usage of container %s failed, %v", containerID, err)
+				} else if uint64(limits.Limit) < usage {
+					return errors.Errorf("memory limit %s is below current usage %d bytes, use --force to update anyway",
+						res.MemoryLimit, usage)
+				}
+			}
+			if err := cgroupManager.Set(updated); err != nil {
+				return errors.WithMessagef(err, "update resources of container %s failed", containerID)
+			}
+		}
+
+		info.Resource = updated
+		return nil
+	})
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// attach 时用于脱离容器的默认按键序列
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// 读到脱离按键序列时返回的错误
+var ErrDetached = errors.New("detached from container")
+
+// 解析逗号分隔的按键序列，支持单个字符与 ctrl-<key>, e.g., ctrl-p,ctrl-q
+func ParseDetachKeys(keys string) ([]byte, error) {
+	var seq []byte
+	for _, key := range strings.Split(keys, ",") {
+		if len(key) == 1 {
+			seq = append(seq, key[0])
+			continue
+		}
+		name, ok := strings.CutPrefix(strings.ToLower(key), "ctrl-")
+		if !ok || len(name) != 1 {
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+		// ctrl-a ~ ctrl-z 对应 1 ~ 26，ctrl-@ [ \ ] ^ _ 对应 0 与 27 ~ 31
+		switch c := name[0]; {
+		case c >= 'a' && c <= 'z':
+			seq = append(seq, c-'a'+1)
+		case c == '@' || (c >= '[' && c <= '_'):
+			seq = append(seq, c-'@')
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return seq, nil
+}
+
+// 过滤输入中的脱离按键序列，读到完整序列时返回 ErrDetached
+// 与序列前缀匹配的输入会暂时保留，后续输入不匹配时再原样输出
+type detachReader struct {
+	r       io.Reader
+	keys    []byte
+	matched int
+	buf     []byte
+	err     error
+}
+
+func NewDetachReader(r io.Reader, keys []byte) io.Reader {
+	return &detachReader{r: r, keys: keys}
+}
+
+func (d *detachReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		raw := make([]byte, len(p))
+		n, err := d.r.Read(raw)
+		for _, b := range raw[:n] {
+			if d.feed(b) {
+				err = ErrDetached
+				break
+			}
+		}
+		if err != nil {
+			if err != ErrDetached {
+				// 输入结束时输出保留的前缀
+				d.buf = append(d.buf, d.keys[:d.matched]...)
+			}
+			d.err = err
+		}
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// 处理一个字节的输入，读到完整序列时返回 true
+func (d *detachReader) feed(b byte) bool {
+	if len(d.keys) == 0 {
+		d.buf = append(d.buf, b)
+		return false
+	}
+	if b == d.keys[d.matched] {
+		d.matched++
+		return d.matched == len(d.keys)
+	}
+	if d.matched > 0 {
+		d.buf = append(d.buf, d.keys[:d.matched]...)
+		d.matched = 0
+		return d.feed(b)
+	}
+	d.buf = append(d.buf, b)
+	return false
+}
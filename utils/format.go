@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// 按照 Go text/template 格式化输出 data，模板中可使用 json 函数输出字段的JSON
+// e.g., --format '{{.Name}} {{json .Resource}}'
+func ExecuteTemplate(w io.Writer, format string, data any) error {
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join":  strings.Join,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}).Parse(format)
+	if err != nil {
+		return errors.Wrapf(err, "parse format %s failed", format)
+	}
+
+	if err = tmpl.Execute(w, data); err != nil {
+		return errors.Wrap(err, "execute template failed")
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// 以缩进的JSON格式输出 data
+func WriteJSON(w io.Writer, data any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(data)
+}
@@ -3,6 +3,11 @@ package utils
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
 func PathExist(path string) (bool, error) {
@@ -17,3 +22,65 @@ func PathExist(path string) (bool, error) {
 
 	return false, fmt.Errorf("can not judge if %s exists, err: %v", path, err)
 }
+
+// 通过 /proc/self/mountinfo 判断 path 是否为挂载点
+func IsMountPoint(path string) (bool, error) {
+	content, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return false, err
+	}
+
+	path = filepath.Clean(path)
+	for _, line := range strings.Split(string(content), "\n") {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(line)
+		if len(fields) > 4 && fields[4] == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 解析 cgroup 中 "key value" 格式的文件, 如 memory.events, cpu.stat
+func ParseKeyValueFile(path string) (map[string]uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[fields[0]] = value
+	}
+	return values, nil
+}
+
+// 向 cgroup 接口文件写入整数, 如 cpu.weight, memory.swappiness
+func WriteInt(path string, value int64) error {
+	return os.WriteFile(path, []byte(strconv.FormatInt(value, 10)), 0644)
+}
+
+func WriteUint(path string, value uint64) error {
+	return os.WriteFile(path, []byte(strconv.FormatUint(value, 10)), 0644)
+}
+
+// 读取只包含一个无符号整数的 cgroup 接口文件, 如 memory.current, pids.current
+func ReadUint(path string) (uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "read %s fail", filepath.Base(path))
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parse %s fail", filepath.Base(path))
+	}
+	return value, nil
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 解析信号名或信号值, e.g., SIGTERM, TERM, 15
+func ParseSignal(sig string) (syscall.Signal, error) {
+	if num, err := strconv.Atoi(sig); err == nil {
+		// 包括 SIGRTMIN ~ SIGRTMAX 在内的信号值范围为 1 ~ 64
+		if num <= 0 || num > 64 {
+			return 0, fmt.Errorf("invalid signal %s", sig)
+		}
+		return syscall.Signal(num), nil
+	}
+
+	name := strings.ToUpper(sig)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	num := unix.SignalNum(name)
+	if num == 0 {
+		return 0, fmt.Errorf("invalid signal %s", sig)
+	}
+	return num, nil
+}
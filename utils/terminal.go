@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// 在宿主机终端与容器的伪终端之间转发输入输出
+type TerminalProxy struct {
+	master     *os.File
+	restore    func()
+	stopResize func()
+	done       chan struct{}
+}
+
+// 宿主机终端设置为 raw 模式，使 Ctrl-C 等控制字符交由伪终端处理，
+// 同时监听 SIGWINCH，将宿主机终端的窗口大小同步到伪终端
+func NewTerminalProxy(master *os.File) (*TerminalProxy, error) {
+	restore, err := MakeStdinRaw()
+	if err != nil {
+		return nil, err
+	}
+	p := &TerminalProxy{
+		master:  master,
+		restore: restore,
+		done:    make(chan struct{}),
+	}
+
+	_ = pty.InheritSize(os.Stdin, master)
+	p.stopResize = NotifyWinch(func() {
+		_ = pty.InheritSize(os.Stdin, master)
+	})
+
+	go func() {
+		_, _ = io.Copy(master, os.Stdin)
+	}()
+	// 伪终端的所有 slave 端关闭后读取 master 会返回 EIO，此时输出转发结束
+	go func() {
+		_, _ = io.Copy(os.Stdout, master)
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// 等待剩余输出转发完成并恢复宿主机终端，需要在伪终端中的进程退出后调用
+func (p *TerminalProxy) Close() {
+	<-p.done
+	p.stopResize()
+	p.restore()
+	_ = p.master.Close()
+}
+
+// 宿主机标准输入为终端时将其设置为 raw 模式，返回的函数用于恢复终端
+func MakeStdinRaw() (func(), error) {
+	stdinFd := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdinFd) {
+		return func() {}, nil
+	}
+	state, err := term.MakeRaw(stdinFd)
+	if err != nil {
+		return nil, errors.Wrap(err, "set terminal raw mode failed")
+	}
+	return func() { _ = term.Restore(stdinFd, state) }, nil
+}
+
+// 宿主机终端窗口大小变化时调用 resize，返回的函数用于停止监听
+func NotifyWinch(resize func()) func() {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			resize()
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(winch)
+	}
+}